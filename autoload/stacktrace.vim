@@ -10,11 +10,11 @@ set cpo&vim
 let g:stacktrace#debug = v:false
 
 function! stacktrace#callstack() abort
-  return ch_evalexpr(s:job_start(), {'id': 'stacktrace#callstack'})
+  return s:request({'id': 'stacktrace#callstack'}, [])
 endfunction
 
 function! stacktrace#build(throwpoint) abort
-  return ch_evalexpr(s:job_start(), {'id': 'stacktrace#build', 'throwpoint': a:throwpoint})
+  return s:request({'id': 'stacktrace#build', 'throwpoint': a:throwpoint}, [a:throwpoint])
 endfunction
 
 function! stacktrace#histerrs(...) abort
@@ -22,11 +22,41 @@ function! stacktrace#histerrs(...) abort
   if msghist ==# ''
     let msghist = execute(':message')
   endif
-  return ch_evalexpr(s:job_start(), {'id': 'stacktrace#histerrs', 'msghist': msghist})
+  return s:request({'id': 'stacktrace#histerrs', 'msghist': msghist}, [msghist])
+endfunction
+
+function! stacktrace#histgroups(...) abort
+  let msghist = get(a:, 1, '')
+  if msghist ==# ''
+    let msghist = execute(':message')
+  endif
+  return s:request({'id': 'stacktrace#histgroups', 'msghist': msghist}, [msghist])
 endfunction
 
 function! stacktrace#fromhist() abort
-  return ch_evalexpr(s:job_start(), {'id': 'stacktrace#fromhist'})
+  return s:request({'id': 'stacktrace#fromhist'}, [])
+endfunction
+
+function! stacktrace#snapshot(file) abort
+  call s:notify({'id': 'stacktrace#snapshot', 'file': a:file}, [a:file])
+endfunction
+
+" s:request sends body to Vim's JSON channel, or calls the method of body.id
+" with args over msgpack-RPC in Neovim.
+function! s:request(body, args) abort
+  if has('nvim')
+    return call('rpcrequest', [s:nvim_job_start(), a:body.id] + a:args)
+  endif
+  return ch_evalexpr(s:job_start(), a:body)
+endfunction
+
+" s:notify is s:request without waiting for the response.
+function! s:notify(body, args) abort
+  if has('nvim')
+    call call('rpcnotify', [s:nvim_job_start(), a:body.id] + a:args)
+    return
+  endif
+  call ch_sendexpr(s:job_start(), a:body)
 endfunction
 
 function! s:err_cb(ch, msg) abort
@@ -67,6 +97,15 @@ function! s:job_start() abort
   return s:job
 endfunction
 
+function! s:nvim_job_start() abort
+  if exists('s:nvim_job') && jobwait([s:nvim_job], 0)[0] == -1
+    return s:nvim_job
+  endif
+  let cmd = type(s:cmd) == type([]) ? s:cmd : [s:cmd]
+  let s:nvim_job = jobstart(cmd + ['-nvim'], {'rpc': v:true})
+  return s:nvim_job
+endfunction
+
 let &cpo = s:save_cpo
 unlet s:save_cpo
 " __END__
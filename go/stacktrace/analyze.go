@@ -0,0 +1,200 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Cause is the root cause of an error found by Analyze.
+//
+// vimdoc:type:
+//	Cause *stacktrace-type-cause*
+type Cause struct {
+	// The root cause message. It's the message of the related error if the
+	// error is caused by it.
+	Message string `json:"message"`
+
+	// Throwpoint or location of the root cause message.
+	Location string `json:"location"`
+
+	// The messages of the error caused by the root cause.
+	FollowOns []string `json:"follow_ons,omitempty"`
+
+	// Name of the rule which finds the cause. "cascade", "missing_end" or
+	// "uncaught_exception". It's empty if no rule is matched.
+	Rule string `json:"rule,omitempty"`
+
+	// The error which has the root cause if it isn't the error itself.
+	Related *Error `json:"-"`
+}
+
+const (
+	ruleCascade           = "cascade"
+	ruleMissingEnd        = "missing_end"
+	ruleUncaughtException = "uncaught_exception"
+)
+
+var (
+	// The errors which follow another error in the same line.
+	// e.g. "E121: Undefined variable: x" -> "E15: Invalid expression: x"
+	cascadeCodes = map[string]bool{
+		"E15":  true, // Invalid expression
+		"E116": true, // Invalid arguments for function
+	}
+
+	// The errors at the end of the function or the script which are caused
+	// by the broken :if, :while, :for or :try before them.
+	missingEndCodes = map[string]bool{
+		"E170": true, // Missing :endwhile, :endfor
+		"E171": true, // Missing :endif
+		"E600": true, // Missing :endtry
+	}
+
+	// e.g. "E605: Exception not caught: Vim(let):E121: Undefined variable: x"
+	vimExceptionRegex = regexp.MustCompile(`^E605: .*?Vim(?:\(\w+\))?:(E\d+: .*)$`)
+)
+
+// analyzeWindow is the number of the recent errors where the related error is
+// looked for.
+const analyzeWindow = 100
+
+// Analyze finds the root causes of the errors in the order of message history
+// by rules and sets Error.Cause. The related error is looked for in the last
+// analyzeWindow errors.
+//   - cascade: the errors like E15 follow the first error of the line.
+//   - missing_end: E171 is caused by the error just before it in message
+//     history in the same call of the function or the script, which breaks
+//     :if. E170 and E600 are the same.
+//   - uncaught_exception: E605 of the exception converted from an error is
+//     caused by the error, which is linked to the previous same error.
+func Analyze(errs []*Error) {
+	for i, e := range errs {
+		start := i - analyzeWindow
+		if start < 0 {
+			start = 0
+		}
+		e.Cause = analyze(e, errs[start:i])
+	}
+}
+
+// histerrsAnalyzed returns the errors in message history with the root causes
+// as stacktrace#histerrs and the histerrs command return.
+func histerrsAnalyzed(msghist string) []*Error {
+	errs := Histerrs(msghist)
+	Analyze(errs)
+	return errs
+}
+
+// analyze returns the root cause of e. prev is the errors before e, which are
+// already analyzed, i.e. they have Cause.
+func analyze(e *Error, prev []*Error) *Cause {
+	c := &Cause{Location: e.location()}
+	if len(e.Messages) == 0 {
+		return c
+	}
+	root := 0
+	for i, msg := range e.Messages {
+		if !cascadeCodes[msgCode(msg)] {
+			root = i
+			break
+		}
+	}
+	c.Message = e.Messages[root]
+	for i, msg := range e.Messages {
+		if i == root {
+			continue
+		}
+		c.FollowOns = append(c.FollowOns, msg)
+		if cascadeCodes[msgCode(msg)] {
+			c.Rule = ruleCascade
+		}
+	}
+
+	code := msgCode(c.Message)
+	switch {
+	case missingEndCodes[code]:
+		// The errors in the same call are continuous in message history, e.g.
+		// "line 2:" and "line 5:" after the same "Error detected while
+		// processing" line. The error in another call is another run.
+		if len(prev) > 0 && sameRun(prev[len(prev)-1], e) {
+			c.link(e, prev[len(prev)-1], ruleMissingEnd)
+		}
+	case vimExceptionRegex.MatchString(c.Message):
+		msg := vimExceptionRegex.FindStringSubmatch(c.Message)[1]
+		c.FollowOns = append([]string{c.Message}, c.FollowOns...)
+		c.Message, c.Rule = msg, ruleUncaughtException
+		for j := len(prev) - 1; j >= 0; j-- {
+			if prev[j].Cause.Message == msg {
+				c.link(e, prev[j], ruleUncaughtException)
+				break
+			}
+		}
+	}
+	return c
+}
+
+// link makes e the follow-on error of the related error.
+func (c *Cause) link(e, related *Error, rule string) {
+	rc := related.Cause
+	c.Message, c.Location, c.Rule = rc.Message, rc.Location, rule
+	c.FollowOns = append([]string(nil), e.Messages...)
+	c.Related = related
+	if rc.Related != nil {
+		c.Related = rc.Related
+	}
+}
+
+// messages returns the messages of e with the root cause first.
+func (e *Error) messages() []string {
+	c := e.Cause
+	if c == nil || c.Message == "" {
+		return e.Messages
+	}
+	root := c.Message
+	if c.Related != nil {
+		root += " (" + c.Location + ")"
+	}
+	return append([]string{root}, c.FollowOns...)
+}
+
+// msgCode returns the code of the message. e.g. E121
+func msgCode(msg string) string {
+	code := histerrsErrRegex.FindString(msg)
+	if code == "" {
+		code = histerrsWarnRegex.FindString(msg)
+	}
+	return strings.TrimSuffix(code, ":")
+}
+
+// sameRun reports whether the errors are in the same run of the function or
+// the script call, i.e. b follows a in message history without other lines in
+// the same context.
+func sameRun(a, b *Error) bool {
+	return a.EndLnum > 0 && a.EndLnum+1 == b.Lnum && sameContext(a.Throwpoint, b.Throwpoint)
+}
+
+// sameContext reports whether the throwpoints are in the same function or
+// script call, i.e. only the line numbers of the last frames differ.
+func sameContext(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	ta, err := ParseThrowpoint(a)
+	if err != nil {
+		return false
+	}
+	tb, err := ParseThrowpoint(b)
+	if err != nil || len(ta.Frames) != len(tb.Frames) {
+		return false
+	}
+	for i := range ta.Frames {
+		fa, fb := *ta.Frames[i], *tb.Frames[i]
+		if i == len(ta.Frames)-1 {
+			fa.Lnum, fb.Lnum = 0, 0
+		}
+		if fa != fb {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package stacktrace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	msghist := `
+Error detected while processing function F:
+line    3:
+E121: Undefined variable: x
+E15: Invalid expression: x + 1
+Error detected while processing function Unclosed:
+line    2:
+E492: Not an editor command:     endfi
+line    5:
+E171: Missing :endif
+Error detected while processing function G:
+line    1:
+E121: Undefined variable: y
+E15: Invalid expression: y
+Error detected while processing function Main[1]..H:
+line    2:
+E605: Exception not caught: Vim(let):E121: Undefined variable: y
+Error detected while processing function I:
+line    9:
+E171: Missing :endif
+Error detected while processing function Unclosed:
+line    5:
+E171: Missing :endif
+`
+	errs := Histerrs(msghist)
+	Analyze(errs)
+	want := []*Cause{
+		{
+			Message:   "E121: Undefined variable: x",
+			Location:  "function F[3]",
+			FollowOns: []string{"E15: Invalid expression: x + 1"},
+			Rule:      ruleCascade,
+		},
+		{
+			Message:  "E492: Not an editor command:     endfi",
+			Location: "function Unclosed[2]",
+		},
+		{
+			Message:   "E492: Not an editor command:     endfi",
+			Location:  "function Unclosed[2]",
+			FollowOns: []string{"E171: Missing :endif"},
+			Rule:      ruleMissingEnd,
+			Related:   errs[1],
+		},
+		{
+			Message:   "E121: Undefined variable: y",
+			Location:  "function G[1]",
+			FollowOns: []string{"E15: Invalid expression: y"},
+			Rule:      ruleCascade,
+		},
+		{
+			Message:   "E121: Undefined variable: y",
+			Location:  "function G[1]",
+			FollowOns: []string{"E605: Exception not caught: Vim(let):E121: Undefined variable: y"},
+			Rule:      ruleUncaughtException,
+			Related:   errs[3],
+		},
+		{ // E171 without the previous error is the root cause itself.
+			Message:  "E171: Missing :endif",
+			Location: "function I[9]",
+		},
+		{ // E171 in another call isn't caused by the error of the first call.
+			Message:  "E171: Missing :endif",
+			Location: "function Unclosed[5]",
+		},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Histerrs() returns %d errors, want %d", len(errs), len(want))
+	}
+	for i, e := range errs {
+		if !reflect.DeepEqual(e.Cause, want[i]) {
+			t.Errorf("Cause of %v =\n%#v, want\n%#v", e.Throwpoint, e.Cause, want[i])
+		}
+	}
+
+	if got, want := strings.Join(errs[2].messages(), ", "), "E492: Not an editor command:     endfi (function Unclosed[2]), E171: Missing :endif"; got != want {
+		t.Errorf("messages() = %q, want %q", got, want)
+	}
+	stacktrace, err := (&Vim{c: offlineClient{}}).buildError(errs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stacktrace.Stacks[0].Text, "E121: Undefined variable: x, E15: Invalid expression: x + 1 : F:3:"; got != want {
+		t.Errorf("the text of stack = %q, want %q", got, want)
+	}
+}
+
+func TestSameContext(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"function F[1]..G[2]", "function F[1]..G[5]", true},
+		{"function F[1]..G[2]", "function F[2]..G[5]", false},
+		{"function F[1]..G[2]", "function F[1]..H[2]", false},
+		{"function F[1]..G[2]", "function G[2]", false},
+		{"/path/to/file.vim[1]", "/path/to/file.vim[9]", true},
+		{"", "function F[1]", false},
+	}
+	for _, tt := range tests {
+		if got := sameContext(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameContext(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
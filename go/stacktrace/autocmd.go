@@ -0,0 +1,123 @@
+package stacktrace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// autocmdDef represents an autocommand definition in :verbose autocmd.
+type autocmdDef struct {
+	Group    string
+	Event    string
+	Pattern  string
+	Cmd      string
+	Filename string
+	Lnum     int
+}
+
+// autocmdPatternIndent and autocmdCmdIndent are indents of pattern and
+// command lines in :autocmd listing.
+const (
+	autocmdPatternIndent = "    "
+	autocmdCmdIndent     = "              "
+)
+
+// parseAutocmds parses :verbose autocmd output.
+// e.g.
+//
+//	--- Autocommands ---
+//	mygroup  User
+//	    Foo       call F()
+//		Last set from /path/to/file.vim line 2
+//	              call G()
+//		Last set from /path/to/file.vim line 3
+//	BufWritePost
+//	    *.go      call go#fmt#Format()
+//		Last set from /path/to/ftplugin/go.vim line 12
+func parseAutocmds(out string) []*autocmdDef {
+	var (
+		defs         []*autocmdDef
+		group, event string
+		pattern      string
+		last         *autocmdDef
+	)
+	addCmd := func(cmd string) {
+		last = &autocmdDef{Group: group, Event: event, Pattern: pattern, Cmd: cmd}
+		defs = append(defs, last)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case line == "" || strings.HasPrefix(line, "--- "):
+			continue
+		case strings.HasPrefix(line, "\t"):
+			if file, lnum, ok := parseLastSet(line); ok && last != nil {
+				last.Filename, last.Lnum = file, lnum
+			}
+		case strings.HasPrefix(line, autocmdCmdIndent):
+			if event != "" && pattern != "" {
+				addCmd(strings.TrimLeft(line, " "))
+			}
+		case strings.HasPrefix(line, autocmdPatternIndent):
+			fields := strings.SplitN(strings.TrimLeft(line, " "), " ", 2)
+			pattern, last = fields[0], nil
+			// the command is in the next line if the pattern is long.
+			if len(fields) == 2 {
+				addCmd(strings.TrimLeft(fields[1], " "))
+			}
+		default:
+			fields := strings.Fields(line)
+			group, event, pattern, last = "", "", "", nil
+			switch len(fields) {
+			case 1:
+				event = fields[0]
+			case 2:
+				group, event = fields[0], fields[1]
+			}
+		}
+	}
+	return defs
+}
+
+// buildAutocmdStack builds stack from autocmd frame. It uses the first
+// definition of the autocommand because throwpoint doesn't tell which command
+// is executed.
+func (cli *Vim) buildAutocmdStack(event, pattern string) *Stack {
+	e := &Stack{
+		Kind:    FrameAutocmd,
+		Event:   event,
+		Pattern: pattern,
+		Text:    fmt.Sprintf("%s %s:", event, pattern),
+	}
+	out, err := cli.autocmd(event, pattern)
+	if err != nil {
+		if !isAutocmd(event, pattern) {
+			e.fail(StatusInvalid, "%v", err)
+		} else {
+			e.fail(StatusNotFound, "autocmd %s %s is not found: %v", event, pattern, err)
+		}
+		return e
+	}
+	var def *autocmdDef
+	for _, d := range parseAutocmds(out) {
+		if strings.EqualFold(d.Event, event) && d.Pattern == pattern {
+			def = d
+			break
+		}
+	}
+	if def == nil {
+		e.fail(StatusNotFound, "autocmd %s %s is not found", event, pattern)
+		return e
+	}
+	e.Line = def.Cmd
+	e.Text += " " + def.Cmd
+	e.Filename = def.Filename
+	e.Lnum = def.Lnum
+	// Neovim's Lua callback has its location in the command.
+	if file, lnum, ok := parseNvimLuaCallback(def.Cmd); ok {
+		e.Filename, e.Lnum = file, lnum
+	}
+	if e.Filename == "" {
+		e.fail(StatusNoFile, "autocmd %s %s is not defined in a file", event, pattern)
+	}
+	return e
+}
@@ -0,0 +1,75 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseAutocmds(t *testing.T) {
+	out := `
+--- Autocommands ---
+T  User
+    Foo       call H()
+	Last set from /path/to/file.vim line 2
+              call H2()
+	Last set from /path/to/file.vim line 3
+    averyveryverylongpattern*.go
+              call X()
+	Last set from /path/to/file.vim line 4
+User
+    Foo       echo 1
+BufWritePost
+    *.go      echo 2
+	Last set from /path/to/file.vim
+`
+	want := []*autocmdDef{
+		{Group: "T", Event: "User", Pattern: "Foo", Cmd: "call H()", Filename: "/path/to/file.vim", Lnum: 2},
+		{Group: "T", Event: "User", Pattern: "Foo", Cmd: "call H2()", Filename: "/path/to/file.vim", Lnum: 3},
+		{Group: "T", Event: "User", Pattern: "averyveryverylongpattern*.go", Cmd: "call X()", Filename: "/path/to/file.vim", Lnum: 4},
+		{Event: "User", Pattern: "Foo", Cmd: "echo 1"},
+		{Event: "BufWritePost", Pattern: "*.go", Cmd: "echo 2", Filename: "/path/to/file.vim"},
+	}
+	got := parseAutocmds(out)
+	if !reflect.DeepEqual(got, want) {
+		for _, d := range got {
+			t.Errorf("got : %#v", d)
+		}
+		for _, d := range want {
+			t.Logf("want: %#v", d)
+		}
+	}
+}
+
+func TestVim_buildAutocmdStack(t *testing.T) {
+	scripts := `
+augroup vim-stacktrace-test
+  autocmd!
+  autocmd User VimStacktraceTest call F()
+augroup END
+`
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	defer os.Remove(tmp.Name())
+	tmp.WriteString(scripts)
+	filename := tmp.Name()
+
+	v := &Vim{c: cli}
+	cli.Ex(":source " + filename)
+	want := &Stack{
+		Kind:     FrameAutocmd,
+		Event:    "User",
+		Pattern:  "VimStacktraceTest",
+		Line:     "call F()",
+		Filename: filename,
+		Lnum:     4,
+		Text:     "User VimStacktraceTest: call F()",
+	}
+	if got := v.buildAutocmdStack("User", "VimStacktraceTest"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Vim.buildAutocmdStack(User, VimStacktraceTest) = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package stacktrace
+
+import vim "github.com/haya14busa/vim-go-client"
+
+// batchClient is the client which returns the outputs of Ex commands fetched
+// in advance by a single call instead of calling execute() for each frame.
+// The other calls are passed through to the underlying client.
+type batchClient struct {
+	client
+	// output by Ex command. It's empty if the command failed.
+	outputs map[exCmd]string
+}
+
+func (c *batchClient) Call(funcname string, args ...interface{}) (vim.Body, error) {
+	if funcname == "map" && len(args) == 2 && args[1] == executeExpr {
+		if cmds, ok := args[0].([][]string); ok {
+			if outs, ok := c.lookup(cmds); ok {
+				return outs, nil
+			}
+		}
+	}
+	return c.client.Call(funcname, args...)
+}
+
+// lookup returns the fetched outputs of the commands for executeAll.
+func (c *batchClient) lookup(cmds [][]string) ([]interface{}, bool) {
+	outs := make([]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		out, ok := c.outputs[exCmd{Cmd: cmd[0], Arg: cmd[1]}]
+		if !ok {
+			return nil, false
+		}
+		outs = append(outs, out)
+	}
+	return outs, true
+}
+
+// batchCmds returns the Ex commands to build the stacks of tp without
+// duplicates. The frames with invalid name aren't looked up and their stacks
+// are StatusInvalid.
+func batchCmds(tp *Throwpoint) []exCmd {
+	cmds := []exCmd{scriptnamesCmd}
+	seen := map[exCmd]bool{scriptnamesCmd: true}
+	for _, f := range tp.Frames {
+		var cmd exCmd
+		switch f.Kind {
+		case FrameFunction, FrameLambda, FrameDict:
+			if !isFuncname(f.Name) {
+				continue
+			}
+			cmd = functionCmd(f.Name)
+		case FrameAutocmd:
+			if !isAutocmd(f.Event, f.Pattern) {
+				continue
+			}
+			cmd = autocmdCmd
+		default:
+			continue
+		}
+		if !seen[cmd] {
+			seen[cmd] = true
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// prefetch returns Vim which uses the outputs of the Ex commands for tp
+// fetched by a single round-trip. It returns cli itself if it fails, e.g.
+// without Vim.
+func (cli *Vim) prefetch(tp *Throwpoint) *Vim {
+	if _, ok := cli.c.(*batchClient); ok {
+		return cli
+	}
+	cmds := batchCmds(tp)
+	outs, err := cli.executeAll(cmds)
+	if err != nil {
+		return cli
+	}
+	c := &batchClient{client: cli.c, outputs: make(map[exCmd]string, len(cmds))}
+	for i, cmd := range cmds {
+		c.outputs[cmd] = outs[i]
+	}
+	return &Vim{c: c, rtp: cli.rtp, cache: cli.sources()}
+}
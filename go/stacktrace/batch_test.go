@@ -0,0 +1,119 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	vim "github.com/haya14busa/vim-go-client"
+)
+
+func TestBatchCmds(t *testing.T) {
+	tp, err := ParseThrowpoint(`function F[1]..<SNR>3_f[2]..<SNR>3_f[2]..1[1]..<lambda>1[1]..User Autocommands for "Foo"..function F[3]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []exCmd{
+		{Cmd: ":scriptnames"},
+		{Cmd: ":verbose function {v:val[1]}", Arg: "F"},
+		{Cmd: ":verbose function <SNR>{v:val[1]}", Arg: "3_f"},
+		{Cmd: ":verbose function {v:val[1]}", Arg: "1"},
+		{Cmd: ":verbose function {v:val[1]}", Arg: "<lambda>1"},
+		{Cmd: ":verbose autocmd"},
+	}
+	if got := batchCmds(tp); !reflect.DeepEqual(got, want) {
+		t.Errorf("batchCmds() = %q, want %q", got, want)
+	}
+}
+
+// countClient counts the calls.
+type countClient struct {
+	client
+	n int
+}
+
+func (c *countClient) Call(funcname string, args ...interface{}) (vim.Body, error) {
+	c.n++
+	return c.client.Call(funcname, args...)
+}
+
+// deepThrowpoint returns the throwpoint of the recursive function calls.
+func deepThrowpoint(tb testing.TB, depth int) (string, func()) {
+	scripts := `
+function! s:recursive(n) abort
+  if a:n == 0
+    return expand('<sfile>')
+  endif
+  return s:recursive(a:n - 1)
+endfunction
+
+function! Deep(n) abort
+  return s:recursive(a:n)
+endfunction
+`
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tmp.WriteString(scripts)
+	tmp.Close()
+	cleanup := func() { os.Remove(tmp.Name()) }
+	if _, err := cli.Call("execute", ":source "+tmp.Name()); err != nil {
+		cleanup()
+		tb.Fatal(err)
+	}
+	throwpoint, err := cli.Call("Deep", depth)
+	if err != nil {
+		cleanup()
+		tb.Fatal(err)
+	}
+	return throwpoint.(string), cleanup
+}
+
+func TestVim_prefetch(t *testing.T) {
+	throwpoint, cleanup := deepThrowpoint(t, 50)
+	defer cleanup()
+
+	c := &countClient{client: cli}
+	got, err := (&Vim{c: c}).Build(throwpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.n != 1 {
+		t.Errorf("Vim.Build() calls Vim %d times, want 1", c.n)
+	}
+	want, err := (&Vim{c: &batchClient{client: cli}}).Build(throwpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Vim.Build() with prefetch = %v, want %v", got, want)
+	}
+	// the caller frame, Deep and 51 calls of s:recursive
+	if len(got.Stacks) != 53 || got.Stacks[51].Lnum != 6 {
+		t.Errorf("Vim.Build() = %d stacks, %#v", len(got.Stacks), got.Stacks[51])
+	}
+}
+
+func BenchmarkVim_Build(b *testing.B) {
+	throwpoint, cleanup := deepThrowpoint(b, 90)
+	defer cleanup()
+	b.Run("batch", func(b *testing.B) {
+		v := &Vim{c: cli}
+		for i := 0; i < b.N; i++ {
+			if _, err := v.Build(throwpoint); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("perframe", func(b *testing.B) {
+		// batchClient without outputs calls Vim for each frame.
+		v := &Vim{c: &batchClient{client: cli}}
+		for i := 0; i < b.N; i++ {
+			if _, err := v.Build(throwpoint); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
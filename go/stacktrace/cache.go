@@ -0,0 +1,135 @@
+package stacktrace
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	vimlparser "github.com/haya14busa/go-vimlparser"
+)
+
+// sourceCache caches the source files and their function indexes across
+// requests. An entry is invalidated when the modification time or the size
+// of the file changes.
+type sourceCache struct {
+	mu    sync.Mutex
+	files map[string]*sourceFile
+
+	// snapshots of the files as they were sourced. They take precedence over
+	// the files on disk.
+	snapshots map[string]*sourceFile
+	// paths of the snapshots in the order they're taken and their total size.
+	// The oldest ones are dropped when the size exceeds maxSnapshotSize.
+	snapshotOrder   []string
+	snapshotSize    int
+	maxSnapshotSize int
+}
+
+// defaultMaxSnapshotSize is the limit of the total size of the snapshots.
+const defaultMaxSnapshotSize = 32 << 20
+
+// sourceFile is a cached source file.
+type sourceFile struct {
+	modTime time.Time
+	size    int64
+	src     []byte
+	lines   []string
+
+	// function index built on demand. It's nil if the file cannot be parsed.
+	idx     *funcIndex
+	indexed bool
+}
+
+func newSourceCache() *sourceCache {
+	return &sourceCache{
+		files:           make(map[string]*sourceFile),
+		snapshots:       make(map[string]*sourceFile),
+		maxSnapshotSize: defaultMaxSnapshotSize,
+	}
+}
+
+// file returns the snapshot or the cached source file.
+func (c *sourceCache) file(path string) (*sourceFile, error) {
+	c.mu.Lock()
+	f, ok := c.snapshots[path]
+	c.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.files[path]; ok && f.modTime.Equal(fi.ModTime()) && f.size == fi.Size() {
+		return f, nil
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		delete(c.files, path)
+		return nil, err
+	}
+	f = newSourceFile(src)
+	f.modTime, f.size = fi.ModTime(), fi.Size()
+	c.files[path] = f
+	return f, nil
+}
+
+func newSourceFile(src []byte) *sourceFile {
+	return &sourceFile{src: src, lines: strings.Split(string(src), "\n")}
+}
+
+// line returns the text of the line. lnum is 1-based.
+func (f *sourceFile) line(lnum int) (string, bool) {
+	if lnum < 1 || len(f.lines) < lnum {
+		return "", false
+	}
+	return strings.TrimSuffix(f.lines[lnum-1], "\r"), true
+}
+
+// funcIndex returns the function index of the file. It returns nil if the
+// file cannot be parsed.
+func (c *sourceCache) funcIndex(path string) *funcIndex {
+	f, err := c.file(path)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !f.indexed {
+		f.idx = newFuncIndex(path, f.src, f.lines)
+		f.indexed = true
+	}
+	return f.idx
+}
+
+// newFuncIndex builds function index of the source. It returns nil if the
+// source cannot be parsed.
+func newFuncIndex(path string, src []byte, lines []string) *funcIndex {
+	if isVim9script(lines) {
+		return vim9FuncLines(lines)
+	}
+	node, err := vimlparser.ParseFile(bytes.NewReader(src), path, &vimlparser.ParseOption{})
+	if err != nil {
+		return nil
+	}
+	idx := funcLines(node)
+	idx.lines = lines
+	return idx
+}
+
+// sources returns the source cache of cli.
+func (cli *Vim) sources() *sourceCache {
+	if cli.cache == nil {
+		cli.cache = newSourceCache()
+	}
+	return cli.cache
+}
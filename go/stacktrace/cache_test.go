@@ -0,0 +1,63 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSourceCache(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.WriteString("function! F() abort\nendfunction\n")
+	tmp.Close()
+	filename := tmp.Name()
+
+	c := newSourceCache()
+	f, err := c.file(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := f.line(1); !ok || l != "function! F() abort" {
+		t.Errorf("line(1) = (%q, %v)", l, ok)
+	}
+	if _, ok := f.line(100); ok {
+		t.Error("line(100) should not be found")
+	}
+	idx := c.funcIndex(filename)
+	if idx == nil || idx.names["F"] != 1 {
+		t.Fatalf("funcIndex() = %#v", idx)
+	}
+	if got, _ := c.file(filename); got != f {
+		t.Error("file() should return the cached file")
+	}
+	if got := c.funcIndex(filename); got != idx {
+		t.Error("funcIndex() should return the cached index")
+	}
+
+	// the modification invalidates the cache.
+	if err := ioutil.WriteFile(filename, []byte("\nfunction! F() abort\nendfunction\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.funcIndex(filename); got == nil || got == idx || got.names["F"] != 2 {
+		t.Errorf("funcIndex() after modification = %#v", got)
+	}
+	// the same size but new modification time also invalidates the cache.
+	mtime := time.Now().Add(time.Hour)
+	if err := ioutil.WriteFile(filename, []byte("\n\nfunction! G() abort\nendfunction"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, mtime, mtime)
+	if got := c.funcIndex(filename); got == nil || got.names["G"] != 3 {
+		t.Errorf("funcIndex() after modification = %#v", got)
+	}
+
+	os.Remove(filename)
+	if got, err := c.file(filename); err == nil {
+		t.Errorf("file() of removed file = %#v, want error", got)
+	}
+}
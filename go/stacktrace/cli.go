@@ -0,0 +1,291 @@
+package stacktrace
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	vim "github.com/haya14busa/vim-go-client"
+)
+
+// Output formats of subcommands.
+const (
+	formatJSON        = "json"
+	formatErrorformat = "errorformat"
+)
+
+// command is a subcommand of vim-stacktrace which runs without Vim. It
+// returns the exit status.
+type command struct {
+	usage string
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]*command{
+	"histerrs": {usage: histerrsUsage, run: runHisterrs},
+	"build":    {usage: buildUsage, run: runBuild},
+}
+
+const (
+	histerrsUsage = "histerrs [-format json|errorformat] [-group] [-rtp dirs] [-strict] [file]\n" +
+		"\tParses message history from file or stdin and prints errors."
+	buildUsage = "build [-format json|errorformat] [-rtp dirs] [-strict] [throwpoint]\n" +
+		"\tBuilds stacktrace from throwpoint or stdin and prints it."
+)
+
+var errOffline = errors.New("Vim is not running")
+
+// offlineClient is the client without Vim. All calls fail, so stacks are
+// built only from the throwpoint and the files.
+type offlineClient struct{}
+
+func (offlineClient) Call(funcname string, args ...interface{}) (vim.Body, error) {
+	return nil, errOffline
+}
+
+// options of subcommands.
+type options struct {
+	format string
+	// comma separated runtimepath directories to resolve functions
+	rtp string
+	// fail if any stack is unresolved
+	strict bool
+}
+
+// newFlagSet returns flag set of the subcommand with -format and -rtp flags.
+func newFlagSet(name, usage string, stderr io.Writer) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: vim-stacktrace %s\n", usage)
+		fs.PrintDefaults()
+	}
+	opt := &options{}
+	fs.StringVar(&opt.format, "format", formatJSON, "output format: json or errorformat (%f:%l: %m)")
+	fs.StringVar(&opt.rtp, "rtp", "", "comma separated runtimepath directories to resolve functions offline")
+	fs.BoolVar(&opt.strict, "strict", false, "exit with 1 if any stack is unresolved")
+	return fs, opt
+}
+
+// parseFlags parses args and reports whether the format is valid.
+func parseFlags(fs *flag.FlagSet, opt *options, args []string) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if opt.format != formatJSON && opt.format != formatErrorformat {
+		fmt.Fprintf(fs.Output(), "invalid format: %q\n", opt.format)
+		fs.Usage()
+		return false
+	}
+	return true
+}
+
+// newVim returns Vim without Vim. It resolves functions in the runtimepath
+// directories if given.
+func (opt *options) newVim() (*Vim, error) {
+	if opt.rtp == "" {
+		return &Vim{c: offlineClient{}}, nil
+	}
+	return Offline(strings.Split(opt.rtp, ","))
+}
+
+// openInput opens the file given by the argument or returns stdin.
+func openInput(args []string, stdin io.Reader) (io.ReadCloser, error) {
+	if len(args) > 0 {
+		return os.Open(args[0])
+	}
+	return ioutil.NopCloser(stdin), nil
+}
+
+func runHisterrs(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs, opt := newFlagSet("histerrs", histerrsUsage, stderr)
+	group := fs.Bool("group", false, "group the same errors with the count")
+	if !parseFlags(fs, opt, args) {
+		return 2
+	}
+	in, err := openInput(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	defer in.Close()
+	s := NewHisterrsScanner(in)
+	// all errors for JSON and the groups.
+	errs := []*Error{}
+	// the last analyzeWindow errors to analyze the root cause.
+	recent := []*Error{}
+	next := func() *Error {
+		e := s.Histerr()
+		e.Cause = analyze(e, recent)
+		if len(recent) < analyzeWindow {
+			recent = append(recent, e)
+		} else {
+			copy(recent, recent[1:])
+			recent[len(recent)-1] = e
+		}
+		return e
+	}
+	if *group {
+		for s.Scan() {
+			errs = append(errs, next())
+		}
+		if err := s.Err(); err != nil {
+			fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+			return 1
+		}
+		return opt.writeGroups(GroupErrors(errs), stdout, stderr)
+	}
+	if opt.format == formatJSON {
+		for s.Scan() {
+			errs = append(errs, next())
+		}
+		if err := s.Err(); err != nil {
+			fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+			return 1
+		}
+		return writeJSON(stdout, stderr, errs)
+	}
+	cli, err := opt.newVim()
+	if err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	status := 0
+	// the stacktraces are written as the errors are found.
+	for s.Scan() {
+		stacktrace, err := cli.buildError(next())
+		if err != nil {
+			fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+			status = 1
+			continue
+		}
+		if err := opt.check(stacktrace, stderr); err != nil {
+			status = 1
+		}
+		writeStacks(stdout, stacktrace)
+	}
+	if err := s.Err(); err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	return status
+}
+
+// writeGroups writes the groups of errors. The count of the group is added to
+// the text of the last stack in errorformat.
+func (opt *options) writeGroups(groups []*ErrorGroup, stdout, stderr io.Writer) int {
+	if opt.format == formatJSON {
+		return writeJSON(stdout, stderr, groups)
+	}
+	cli, err := opt.newVim()
+	if err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	status := 0
+	for _, g := range groups {
+		stacktrace, err := cli.buildError(g.Error)
+		if err != nil {
+			fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+			status = 1
+			continue
+		}
+		if err := opt.check(stacktrace, stderr); err != nil {
+			status = 1
+		}
+		if n := len(stacktrace.Stacks); n > 0 {
+			stacktrace.Stacks[n-1].Text += g.countText()
+		}
+		writeStacks(stdout, stacktrace)
+	}
+	return status
+}
+
+func runBuild(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs, opt := newFlagSet("build", buildUsage, stderr)
+	if !parseFlags(fs, opt, args) {
+		return 2
+	}
+	var throwpoint string
+	if fs.NArg() > 0 {
+		throwpoint = strings.Join(fs.Args(), " ")
+	} else {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+			return 1
+		}
+		throwpoint = strings.TrimRight(strings.Replace(string(b), "\r\n", "\n", -1), "\n")
+	}
+	cli, err := opt.newVim()
+	if err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	stacktrace, err := cli.Build(throwpoint)
+	if err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	status := 0
+	if err := opt.check(stacktrace, stderr); err != nil {
+		status = 1
+	}
+	if opt.format == formatJSON {
+		if writeJSON(stdout, stderr, stacktrace) != 0 {
+			return 1
+		}
+		return status
+	}
+	writeStacks(stdout, stacktrace)
+	return status
+}
+
+// check reports the unresolved stacks in strict mode.
+func (opt *options) check(stacktrace *Stacktrace, stderr io.Writer) error {
+	if !opt.strict {
+		return nil
+	}
+	err := unresolved(stacktrace)
+	if err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+	}
+	return err
+}
+
+func writeJSON(stdout, stderr io.Writer, v interface{}) int {
+	if err := json.NewEncoder(stdout).Encode(v); err != nil {
+		fmt.Fprintf(stderr, "vim-stacktrace: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeStacks writes stacks in errorformat %f:%l: %m. The stack without file,
+// e.g. the function not found, is written as %m. :h errorformat
+func writeStacks(w io.Writer, stacktrace *Stacktrace) {
+	for _, s := range stacktrace.Stacks {
+		if s.Filename == "" {
+			fmt.Fprintln(w, s.Text)
+			continue
+		}
+		fmt.Fprintln(w, s)
+	}
+}
+
+// printUsage prints the usage of vim-stacktrace.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: vim-stacktrace [-nvim] [command]")
+	fmt.Fprintln(w, "\nIt serves Vim channel on stdin/stdout without command.")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range []string{"histerrs", "build"} {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	flag.PrintDefaults()
+}
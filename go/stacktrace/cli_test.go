@@ -0,0 +1,114 @@
+package stacktrace
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	defer os.Remove(tmp.Name())
+	tmp.WriteString("\" comment\ncall F()\n")
+	filename := tmp.Name()
+
+	msghist := fmt.Sprintf(`
+Error detected while processing function F:
+line    3:
+E121: Undefined variable: x
+Error detected while processing %s:
+line    2:
+E605: Exception not caught: 0
+`, filename)
+
+	tests := []struct {
+		cmd    string
+		args   []string
+		stdin  string
+		want   string
+		status int
+	}{
+		{
+			cmd:   "histerrs",
+			stdin: msghist,
+			want: `[{"throwpoint":"function F[3]","messages":["E121: Undefined variable: x"],"severity":"error","lnum":2,"end_lnum":4,` +
+				`"cause":{"message":"E121: Undefined variable: x","location":"function F[3]"}},` +
+				`{"throwpoint":"` + filename + `[2]","messages":["E605: Exception not caught: 0"],"severity":"error","lnum":5,"end_lnum":7,` +
+				`"cause":{"message":"E605: Exception not caught: 0","location":"` + filename + `[2]"}}]` + "\n",
+		},
+		{
+			cmd:   "histerrs",
+			args:  []string{"-format", "errorformat"},
+			stdin: msghist,
+			want: "E121: Undefined variable: x : F:3:\n" +
+				filename + ":2: E605: Exception not caught: 0 : call F()\n",
+		},
+		{
+			cmd:   "histerrs",
+			stdin: "",
+			want:  "[]\n",
+		},
+		{
+			cmd:   "histerrs",
+			args:  []string{"-group", "-format=errorformat"},
+			stdin: strings.Repeat("Error detected while processing function F:\nline    3:\nE121: Undefined variable: x\n", 2),
+			want:  "E121: Undefined variable: x : F:3: [2 times since :messages 1]\n",
+		},
+		{
+			cmd:   "histerrs",
+			args:  []string{"-group"},
+			stdin: "",
+			want:  "[]\n",
+		},
+		{
+			cmd:  "build",
+			args: []string{"script " + filename + "[2]..function F[3]"},
+			want: `{"stacks":[{"kind":"script","line":"call F()","filename":"` + filename + `","lnum":2,"text":"call F()"},` +
+				`{"kind":"function","funcname":"F","flnum":3,"text":"F:3:","status":"not_found","error":"function F is not found: Vim is not running"}]}` + "\n",
+		},
+		{
+			cmd:   "build",
+			args:  []string{"-format=errorformat"},
+			stdin: "script " + filename + "[2]..function F[3]\n",
+			want:  filename + ":2: call F()\nF:3:\n",
+		},
+		{
+			cmd:    "build",
+			args:   []string{"function F[1]..G[2], line 3"},
+			status: 1,
+		},
+		{
+			cmd:    "build",
+			args:   []string{"-format", "qf"},
+			status: 2,
+		},
+		{
+			cmd:    "build",
+			args:   []string{"-strict", "-format=errorformat", "script " + filename + "[2]..function F[3]"},
+			want:   filename + ":2: call F()\nF:3:\n",
+			status: 1,
+		},
+		{
+			cmd:  "build",
+			args: []string{"-strict", "-format=errorformat", "script " + filename + "[2]"},
+			want: filename + ":2: call F()\n",
+		},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		status := commands[tt.cmd].run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if status != tt.status {
+			t.Errorf("%s %v: status = %d, want %d: %s", tt.cmd, tt.args, status, tt.status, stderr.String())
+		}
+		if got := stdout.String(); got != tt.want {
+			t.Errorf("%s %v:\ngot:  %q\nwant: %q", tt.cmd, tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/haya14busa/go-vimlparser/ast"
+)
+
+// funcIndex is an index of function definitions in a Vim script file.
+type funcIndex struct {
+	// The line numbers of named functions. g: and <SID> are normalized.
+	// e.g. F, s:f, foo#bar
+	names map[string]int
+
+	// dict functions. e.g. s:obj.method, l:self.run, s:d['f']
+	dicts []*funcDef
+
+	// curly-brace functions. e.g. s:{name}_f
+	curlies []*funcDef
+
+	// lambda expressions. e.g. {-> s:test()}
+	lambdas []*lambdaDef
+
+	// Vim9 class methods by the name without class name. e.g. Method
+	methods []*funcDef
+
+	// lines of the file to compare with function body
+	lines []string
+}
+
+// funcDef represents a function definition which cannot be looked up by name.
+type funcDef struct {
+	// function name in the source
+	name string
+	lnum int
+	// matches function name for curly-brace function
+	re *regexp.Regexp
+}
+
+// funcLines builds function index from given node.
+func funcLines(node ast.Node) *funcIndex {
+	idx := &funcIndex{names: make(map[string]int)}
+	// stack of visiting nodes and enclosing functions
+	var (
+		nodes []ast.Node
+		funcs []*ast.Function
+	)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			if _, ok := nodes[len(nodes)-1].(*ast.Function); ok {
+				funcs = funcs[:len(funcs)-1]
+			}
+			nodes = nodes[:len(nodes)-1]
+			return true
+		}
+		nodes = append(nodes, n)
+		if l, ok := n.(*ast.LambdaExpr); ok {
+			d := &lambdaDef{lnum: l.Pos().Line, col: l.Pos().Column}
+			if len(funcs) > 0 {
+				d.funcLnum = funcs[len(funcs)-1].Pos().Line
+			}
+			idx.lambdas = append(idx.lambdas, d)
+			return true
+		}
+		f, ok := n.(*ast.Function)
+		if !ok {
+			return true
+		}
+		funcs = append(funcs, f)
+		lnum := f.Pos().Line
+		switch fname := f.Name.(type) {
+		case *ast.Ident:
+			idx.names[normalizeFuncname(fname.Name)] = lnum
+		case *ast.DotExpr, *ast.SubscriptExpr:
+			idx.dicts = append(idx.dicts, &funcDef{name: exprString(fname), lnum: lnum})
+		case *ast.CurlyName:
+			idx.curlies = append(idx.curlies, &funcDef{
+				name: exprString(fname),
+				lnum: lnum,
+				re:   curlyNameRegexp(fname),
+			})
+		}
+		return true
+	})
+	return idx
+}
+
+// normalizeFuncname normalizes function name in the source.
+// g:F -> F, <SID>f -> s:f
+func normalizeFuncname(name string) string {
+	switch {
+	case strings.HasPrefix(name, "g:"):
+		return name[len("g:"):]
+	case strings.HasPrefix(name, "<SID>"):
+		return "s:" + name[len("<SID>"):]
+	}
+	return name
+}
+
+// curlyNameRegexp returns regexp which matches the evaluated curly-brace name.
+// s:{name}_f -> ^s:.+_f$
+func curlyNameRegexp(n *ast.CurlyName) *regexp.Regexp {
+	var b strings.Builder
+	for i, p := range n.Parts {
+		switch p := p.(type) {
+		case *ast.CurlyNameLit:
+			v := p.Value
+			if i == 0 {
+				v = normalizeFuncname(v)
+			}
+			b.WriteString(regexp.QuoteMeta(v))
+		default:
+			b.WriteString(".+")
+		}
+	}
+	return regexp.MustCompile("^" + b.String() + "$")
+}
+
+// exprString returns function name expression in the source for debugging.
+func exprString(n ast.Expr) string {
+	switch n := n.(type) {
+	case *ast.Ident:
+		return n.Name
+	case *ast.DotExpr:
+		return exprString(n.Left) + "." + n.Right.Name
+	case *ast.SubscriptExpr:
+		return exprString(n.Left) + "[" + exprString(n.Right) + "]"
+	case *ast.BasicLit:
+		return n.Value
+	case *ast.CurlyName:
+		var b strings.Builder
+		for _, p := range n.Parts {
+			switch p := p.(type) {
+			case *ast.CurlyNameLit:
+				b.WriteString(p.Value)
+			case *ast.CurlyNameExpr:
+				b.WriteString("{" + exprString(p.Value) + "}")
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
+
+// isDictFuncname reports whether funcname is a numbered dict function.
+// e.g. 14, {14}
+func isDictFuncname(funcname string) bool {
+	return allNumRegex.MatchString(strings.TrimSuffix(strings.TrimPrefix(funcname, "{"), "}"))
+}
+
+// lookup returns the line number of the function definition. body is the
+// function body from :function listing and used to find numbered dict
+// function. It returns 0 if not found.
+func (idx *funcIndex) lookup(funcname string, body map[int]string) int {
+	if isDictFuncname(funcname) {
+		return idx.matchBody(idx.dicts, body)
+	}
+	if strings.HasPrefix(funcname, "<SNR>") {
+		funcname = "s:" + funcname[strings.Index(funcname, "_")+1:]
+	}
+	if l, ok := idx.names[funcname]; ok {
+		return l
+	}
+	for _, d := range idx.curlies {
+		if d.re.MatchString(funcname) {
+			return d.lnum
+		}
+	}
+	return idx.lookupMethod(funcname)
+}
+
+// matchBody returns the line number of the function definition whose body
+// matches with given body. It returns 0 if not found or ambiguous.
+func (idx *funcIndex) matchBody(defs []*funcDef, body map[int]string) int {
+	found := 0
+	for _, d := range defs {
+		if !idx.bodyMatches(d.lnum, body) {
+			continue
+		}
+		if found != 0 {
+			return 0
+		}
+		found = d.lnum
+	}
+	return found
+}
+
+// bodyMatches reports whether the function defined at lnum has the body.
+// The line continuation is joined in the body, so it compares the source
+// line as a prefix.
+func (idx *funcIndex) bodyMatches(lnum int, body map[int]string) bool {
+	for flnum, text := range body {
+		i := lnum + flnum - 1
+		if i < 0 || len(idx.lines) <= i {
+			return false
+		}
+		if !strings.HasPrefix(strings.TrimSpace(text), strings.TrimSpace(idx.lines[i])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package stacktrace
+
+import "testing"
+
+func TestFuncIndex_matchBody(t *testing.T) {
+	idx := &funcIndex{
+		lines: []string{
+			"function! s:d.f() dict abort",
+			"  let x = [1,",
+			"        \\ 2]",
+			"  return 1",
+			"endfunction",
+			"function! s:d.g() dict abort",
+			"  return 1",
+			"endfunction",
+			"function! s:d.h() dict abort",
+			"  return 1",
+			"endfunction",
+		},
+	}
+	defs := []*funcDef{{lnum: 1}, {lnum: 6}, {lnum: 9}}
+	tests := []struct {
+		body map[int]string
+		want int
+	}{
+		{body: map[int]string{1: "  let x = [1, 2]", 3: "  return 1"}, want: 1},
+		{body: map[int]string{1: "  return 1"}, want: 0}, // ambiguous
+		{body: map[int]string{1: "  return 2"}, want: 0},
+		{body: map[int]string{100: "  return 1"}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := idx.matchBody(defs, tt.body); got != tt.want {
+			t.Errorf("funcIndex.matchBody(%v) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
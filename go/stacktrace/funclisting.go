@@ -0,0 +1,131 @@
+package stacktrace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// funcListing represents :verbose function output.
+// e.g.
+//
+//	   function F(a, ...) abort dict
+//		Last set from /path/to/file.vim line 3
+//	1    let x = a:a
+//	2    return x
+//	   endfunction
+type funcListing struct {
+	// The first line without indent. e.g. function F(a, ...) abort dict
+	signature string
+
+	// "function" or "def"
+	keyword string
+	name    string
+	args    string
+
+	// The words after the arguments. e.g. abort, dict, range, closure. It's the
+	// return type for def. e.g. [":", "string"]
+	flags []string
+
+	// Body lines keyed by the line number.
+	body map[int]string
+
+	// "Last set from" location. lnum is 0 before Vim 8.1.
+	hasLastSet bool
+	file       string
+	lnum       int
+}
+
+var (
+	// e.g. "   function <SNR>3_f(a, ...) abort", "   def F(x: number): string"
+	funcSignatureRegex = regexp.MustCompile(`^\s*(function|def)\s+([^\s(]+)\((.*)\)(.*)$`)
+	// e.g. "   endfunction", "   enddef"
+	funcEndRegex = regexp.MustCompile(`^\s*end(?:function|def)\s*$`)
+)
+
+// parseFuncListing parses :verbose function output. It returns an error if
+// the output is not function listing.
+func parseFuncListing(out string) (*funcListing, error) {
+	fl := &funcListing{body: make(map[int]string)}
+	lines := strings.Split(strings.Replace(out, "\r\n", "\n", -1), "\n")
+	ended := false
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if fl.signature == "" {
+			m := funcSignatureRegex.FindStringSubmatch(l)
+			if m == nil {
+				return nil, fmt.Errorf("unexpected function listing: %q", l)
+			}
+			fl.signature = strings.TrimSpace(l)
+			fl.keyword, fl.name, fl.args = m[1], m[2], m[3]
+			fl.flags = strings.Fields(strings.Replace(m[4], ":", " : ", 1))
+			continue
+		}
+		if ended {
+			return nil, fmt.Errorf("unexpected line after end of function: %q", l)
+		}
+		if n, text, ok := parseListingLine(l); ok {
+			fl.body[n] = text
+			continue
+		}
+		if funcEndRegex.MatchString(l) {
+			ended = true
+			continue
+		}
+		if len(fl.body) == 0 && !fl.hasLastSet {
+			if file, lnum, ok := parseLastSet(l); ok {
+				fl.hasLastSet, fl.file, fl.lnum = true, file, lnum
+				continue
+			}
+		}
+		return nil, fmt.Errorf("unexpected line in function listing: %q", l)
+	}
+	if fl.signature == "" {
+		return nil, fmt.Errorf("function listing is empty")
+	}
+	if !ended {
+		return nil, fmt.Errorf("function listing of %s is not terminated", fl.name)
+	}
+	return fl, nil
+}
+
+// line returns the body line at flnum. The signature is returned for flnum 0
+// which is the frame without line number.
+func (fl *funcListing) line(flnum int) (string, bool) {
+	if flnum == 0 {
+		return fl.signature, true
+	}
+	l, ok := fl.body[flnum]
+	return l, ok
+}
+
+var funcListingLineRegex = regexp.MustCompile(`^(\d+)`)
+
+// parseListingLine parses a numbered line of :function listing. The line
+// number is padded to 3 columns.
+// e.g. "1    let x = 1" -> (1, "  let x = 1")
+func parseListingLine(l string) (int, string, bool) {
+	m := funcListingLineRegex.FindString(l)
+	if m == "" {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(m)
+	if err != nil {
+		return 0, "", false
+	}
+	w := len(m)
+	if w < 3 {
+		w = 3
+	}
+	if len(l) < w {
+		w = len(l)
+	}
+	if strings.TrimSpace(l[len(m):w]) != "" {
+		// e.g. "1x"
+		return 0, "", false
+	}
+	return n, l[w:], true
+}
@@ -0,0 +1,178 @@
+package stacktrace
+
+import (
+	"reflect"
+	"testing"
+
+	vim "github.com/haya14busa/vim-go-client"
+)
+
+func TestParseFuncListing(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *funcListing
+	}{
+		{
+			in: `
+   function <SNR>3_f(a, ...) abort dict
+	Last set from /path/to/file.vim line 3
+1    let x = a:a
+2    return x
+   endfunction`,
+			want: &funcListing{
+				signature:  "function <SNR>3_f(a, ...) abort dict",
+				keyword:    "function",
+				name:       "<SNR>3_f",
+				args:       "a, ...",
+				flags:      []string{"abort", "dict"},
+				body:       map[int]string{1: "  let x = a:a", 2: "  return x"},
+				hasLastSet: true,
+				file:       "/path/to/file.vim",
+				lnum:       3,
+			},
+		},
+		{
+			in: `
+   def <SNR>3_F(x: number): string
+	Last set from /path/to/file.vim line 10
+1    return string(x)
+   enddef`,
+			want: &funcListing{
+				signature:  "def <SNR>3_F(x: number): string",
+				keyword:    "def",
+				name:       "<SNR>3_F",
+				args:       "x: number",
+				flags:      []string{":", "string"},
+				body:       map[int]string{1: "  return string(x)"},
+				hasLastSet: true,
+				file:       "/path/to/file.vim",
+				lnum:       10,
+			},
+		},
+		{
+			// empty function without Last set from
+			in: "\n   function F()\n   endfunction",
+			want: &funcListing{
+				signature: "function F()",
+				keyword:   "function",
+				name:      "F",
+				flags:     []string{},
+				body:      map[int]string{},
+			},
+		},
+		{
+			// Last set from only. Neovim's Lua has no file.
+			in: "\n   function F()\n\tLast set from Lua\n   endfunction",
+			want: &funcListing{
+				signature:  "function F()",
+				keyword:    "function",
+				name:       "F",
+				flags:      []string{},
+				body:       map[int]string{},
+				hasLastSet: true,
+			},
+		},
+		{
+			in: "\n   function F()\n1\n100  return 100\n   endfunction",
+			want: &funcListing{
+				signature: "function F()",
+				keyword:   "function",
+				name:      "F",
+				flags:     []string{},
+				body:      map[int]string{1: "", 100: "  return 100"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseFuncListing(tt.in)
+		if err != nil {
+			t.Errorf("parseFuncListing(%q) got an error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFuncListing(%q)\ngot:  %#v\nwant: %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseListingLine(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantLnum int
+		wantText string
+		wantOK   bool
+	}{
+		{"1    let x = [1, 2]", 1, "  let x = [1, 2]", true},
+		{"10   return 10", 10, "  return 10", true},
+		{"1000 return 1000", 1000, " return 1000", true},
+		{"\tLast set from /path/to/file.vim line 2", 0, "", false},
+		{"   endfunction", 0, "", false},
+	}
+	for _, tt := range tests {
+		lnum, text, ok := parseListingLine(tt.in)
+		if lnum != tt.wantLnum || text != tt.wantText || ok != tt.wantOK {
+			t.Errorf("parseListingLine(%q) = (%d, %q, %v), want (%d, %q, %v)", tt.in, lnum, text, ok, tt.wantLnum, tt.wantText, tt.wantOK)
+		}
+	}
+}
+
+func TestParseFuncListing_error(t *testing.T) {
+	tests := []string{
+		"",
+		"\n",
+		"E123: Undefined function: F",
+		"   function F()",
+		"   function F()\n1  return 1",
+		"   function F()\nxxx\n   endfunction",
+		"   function F()\n1x return 1\n   endfunction",
+		"   function F()\n   endfunction\n1  return 1",
+		"   endfunction",
+	}
+	for _, tt := range tests {
+		if got, err := parseFuncListing(tt); err == nil {
+			t.Errorf("parseFuncListing(%q) = %#v, want error", tt, got)
+		}
+	}
+}
+
+// listingClient returns the output for any Ex command.
+type listingClient string
+
+func (c listingClient) Call(funcname string, args ...interface{}) (vim.Body, error) {
+	return []interface{}{string(c)}, nil
+}
+
+func TestVim_buildFuncStack_malformed(t *testing.T) {
+	tests := []struct {
+		out   string
+		flnum int
+		want  *Stack
+	}{
+		{
+			out:   "\n   function F()\n\tLast set from /path/to/file.vim line 3\n   endfunction",
+			flnum: 0,
+			want:  &Stack{Funcname: "F", Line: "function F()", Filename: "/path/to/file.vim", Lnum: 3, Text: "F:0:function F()"},
+		},
+		{
+			out:   "\n   function F()\n\tLast set from /path/to/file.vim line 3\n   endfunction",
+			flnum: 2,
+			want:  &Stack{Funcname: "F", Flnum: 2, Filename: "/path/to/file.vim", Text: "F:2:", Status: StatusOutOfRange, Error: "line 2 is not found in function F"},
+		},
+		{
+			out:   "\n   function F()",
+			flnum: 1,
+			want:  &Stack{Funcname: "F", Flnum: 1, Text: "F:1:", Status: StatusMalformed, Error: "function listing of F is not terminated"},
+		},
+		{
+			out:   "unexpected",
+			flnum: 1,
+			want:  &Stack{Funcname: "F", Flnum: 1, Text: "F:1:", Status: StatusMalformed, Error: `unexpected function listing: "unexpected"`},
+		},
+	}
+	for _, tt := range tests {
+		v := &Vim{c: listingClient(tt.out)}
+		if got := v.buildFuncStack(&Frame{Name: "F", Lnum: tt.flnum}, nil); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("buildFuncStack() with %q\ngot:  %#v\nwant: %#v", tt.out, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package stacktrace
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// ErrorGroup is the group of the same errors by Error.Fingerprint. e.g. the
+// errors in a loop or CursorMoved autocmd
+//
+// vimdoc:type:
+//	ErrorGroup *stacktrace-type-errorgroup*
+type ErrorGroup struct {
+	Fingerprint string `json:"fingerprint"`
+
+	// The last error of the group |stacktrace-type-error|
+	Error *Error `json:"error"`
+
+	// The number of the errors
+	Count int `json:"count"`
+
+	// The first lines of the first and the last errors in message history
+	FirstLnum int `json:"first_lnum"`
+	LastLnum  int `json:"last_lnum"`
+}
+
+var digitsRegex = regexp.MustCompile(`\d+`)
+
+// Fingerprint returns the fingerprint of the error to group the same errors.
+// It's the hash of the normalized throwpoint and the codes of the messages,
+// which ignores the variable parts such as the number of lambda. The
+// messages without the code are used without numbers.
+func (e *Error) Fingerprint() string {
+	h := sha1.New()
+	if e.Throwpoint != "" {
+		fmt.Fprintln(h, stableThrowpoint(e.Throwpoint))
+	} else {
+		fmt.Fprintln(h, e.location())
+	}
+	for _, msg := range e.Messages {
+		if code := msgCode(msg); code != "" {
+			fmt.Fprintln(h, code)
+		} else {
+			fmt.Fprintln(h, digitsRegex.ReplaceAllString(msg, "N"))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// stableThrowpoint removes the numbers of lambda and numbered dict function
+// from the throwpoint, which change for each call.
+// e.g. function F[1]..<lambda>12[1]..34[2] -> function F[1]..<lambda>[1]..{}[2]
+func stableThrowpoint(throwpoint string) string {
+	tp, err := ParseThrowpoint(throwpoint)
+	if err != nil {
+		return throwpoint
+	}
+	frames := make([]*Frame, 0, len(tp.Frames))
+	for _, f := range tp.Frames {
+		nf := *f
+		switch f.Kind {
+		case FrameLambda:
+			nf.Name = "<lambda>"
+		case FrameDict:
+			nf.Name = "{}"
+		}
+		frames = append(frames, &nf)
+	}
+	return (&Throwpoint{Frames: frames}).String()
+}
+
+// Histgroups parses message history and returns the groups of the same
+// errors.
+//
+// vimdoc:func:
+//	stacktrace#histgroups([{string}])	*stacktrace#histgroups()*
+//		Same as |stacktrace#histerrs()|, except the same errors, e.g. in a
+//		loop or |CursorMoved| autocmd, are grouped. Returns list of the
+//		groups |stacktrace-type-errorgroup| in the order of the last errors.
+func Histgroups(msghist string) []*ErrorGroup {
+	return GroupErrors(histerrsAnalyzed(msghist))
+}
+
+// GroupErrors groups the same errors by Error.Fingerprint. The groups are in
+// the order of the last errors.
+func GroupErrors(errs []*Error) []*ErrorGroup {
+	groups := []*ErrorGroup{}
+	byFingerprint := make(map[string]*ErrorGroup)
+	// index of the last error of the group in errs
+	last := make(map[*ErrorGroup]int)
+	for i, e := range errs {
+		fp := e.Fingerprint()
+		g, ok := byFingerprint[fp]
+		if !ok {
+			g = &ErrorGroup{Fingerprint: fp, FirstLnum: e.Lnum}
+			byFingerprint[fp] = g
+			groups = append(groups, g)
+		}
+		g.Error = e
+		g.Count++
+		g.LastLnum = e.Lnum
+		last[g] = i
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return last[groups[i]] < last[groups[j]]
+	})
+	return groups
+}
+
+// candidate returns the line of the group for selectError.
+func (g *ErrorGroup) candidate() string {
+	return g.Error.candidate() + g.countText()
+}
+
+// countText returns the count of the repeated errors. It's empty for a single
+// error.
+func (g *ErrorGroup) countText() string {
+	if g.Count <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" [%d times since :messages %d]", g.Count, g.FirstLnum)
+}
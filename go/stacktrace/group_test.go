@@ -0,0 +1,99 @@
+package stacktrace
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestError_Fingerprint(t *testing.T) {
+	base := &Error{Throwpoint: "function F[1]..<lambda>12[1]..34[2]", Messages: []string{"E121: Undefined variable: x"}}
+	tests := []struct {
+		e    *Error
+		same bool
+	}{
+		{&Error{Throwpoint: "function F[1]..<lambda>13[1]..35[2]", Messages: []string{"E121: Undefined variable: x"}}, true},
+		{&Error{Throwpoint: "function F[1]..<lambda>12[1]..34[2]", Messages: []string{"E121: Undefined variable: y"}}, true},
+		{&Error{Throwpoint: "function F[1]..<lambda>12[1]..34[3]", Messages: []string{"E121: Undefined variable: x"}}, false},
+		{&Error{Throwpoint: "function F[1]..<lambda>12[1]..34[2]", Messages: []string{"E15: Invalid expression: x"}}, false},
+		{&Error{Throwpoint: "function G[1]..<lambda>12[1]..34[2]", Messages: []string{"E121: Undefined variable: x"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.e.Fingerprint() == base.Fingerprint(); got != tt.same {
+			t.Errorf("the fingerprints of %v and %v are the same: %v, want %v", base, tt.e, got, tt.same)
+		}
+	}
+
+	// the numbers in the message without code are ignored.
+	a := &Error{Throwpoint: "function F[1]", Messages: []string{"failed at 12"}}
+	b := &Error{Throwpoint: "function F[1]", Messages: []string{"failed at 13"}}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("the fingerprints of %v and %v should be the same", a, b)
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	var msghist []string
+	for i := 0; i < 3; i++ {
+		msghist = append(msghist,
+			"Error detected while processing CursorMoved Autocommands for \"*\"..function F[1]..<lambda>"+fmt.Sprint(i)+":",
+			"line    1:",
+			"E121: Undefined variable: x",
+		)
+		if i == 0 {
+			msghist = append(msghist,
+				"Error detected while processing function G:",
+				"line    2:",
+				"E15: Invalid expression: y",
+			)
+		}
+	}
+	groups := GroupErrors(Histerrs(strings.Join(msghist, "\n")))
+	if len(groups) != 2 {
+		t.Fatalf("GroupErrors() returns %d groups, want 2", len(groups))
+	}
+	g, f := groups[0], groups[1]
+	if g.Count != 1 || g.Error.Throwpoint != "function G[2]" || g.FirstLnum != 4 || g.LastLnum != 4 {
+		t.Errorf("the group of G = %#v", g)
+	}
+	if f.Count != 3 || f.FirstLnum != 1 || f.LastLnum != 10 || !strings.Contains(f.Error.Throwpoint, "<lambda>2") {
+		t.Errorf("the group of F = %#v", f)
+	}
+	if got, want := f.candidate(), " [3 times since :messages 1]"; !strings.HasSuffix(got, want) {
+		t.Errorf("candidate() = %q, want suffix %q", got, want)
+	}
+}
+
+func TestHistgroups(t *testing.T) {
+	msghist := strings.Repeat(`Error detected while processing function F[1]..<lambda>1:
+line    1:
+E121: Undefined variable: x
+`, 2)
+	groups := Histgroups(msghist)
+	if len(groups) != 1 || groups[0].Count != 2 || groups[0].FirstLnum != 1 || groups[0].LastLnum != 4 {
+		t.Errorf("Histgroups() = %#v", groups)
+	}
+	if groups := Histgroups(""); groups == nil || len(groups) != 0 {
+		t.Errorf("Histgroups('') = %#v, want empty", groups)
+	}
+}
+
+func TestSelectError_group(t *testing.T) {
+	msghist := strings.Repeat(`Error detected while processing function F[1]..<lambda>1:
+line    1:
+E121: Undefined variable: x
+`, 3)
+	defer func(f func(cli *Vim, candidates []string) (int, error)) {
+		inputlist = f
+	}(inputlist)
+	inputlist = func(_ *Vim, candidates []string) (int, error) {
+		return 0, fmt.Errorf("inputlist should not be called: %v", candidates)
+	}
+	got, err := (&Vim{c: cli}).selectError(msghist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Lnum != 7 {
+		t.Errorf("selectError() = %#v, want the last error", got)
+	}
+}
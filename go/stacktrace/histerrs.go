@@ -1,8 +1,12 @@
 package stacktrace
 
 import (
+	"bufio"
+	"crypto/sha1"
 	"fmt"
+	"io"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -22,14 +26,29 @@ type Error struct {
 	//   E121: Undefined variable: err1
 	//   E15: Invalid expression: err1
 	Messages []string `json:"messages"`
+
+	// Severity of the messages. "error", "warning" or "info"
+	Severity Severity `json:"severity"`
+
+	// Line range of the error in message history. It's 1-based.
+	Lnum    int `json:"lnum"`
+	EndLnum int `json:"end_lnum"`
+
+	// Non-error messages just before the error. e.g. the messages of :echomsg
+	Context []string `json:"context,omitempty"`
+
+	// Root cause of the error |stacktrace-type-cause|. It's set by Analyze.
+	Cause *Cause `json:"cause,omitempty"`
+
+	// Traceback of Lua in Neovim, Python, Ruby or Perl in the order of
+	// Stacktrace. Throwpoint is empty if the error isn't from Vim script.
+	Traceback []*Stack `json:"traceback,omitempty"`
 }
 
-const detectedLinePrefix = "Error detected while processing "
+var histerrsErrRegex = regexp.MustCompile(`^E\d+:`)
 
-var (
-	histerrsLineRegex = regexp.MustCompile(`^line\s+(\d+):$`)
-	histerrsErrRegex  = regexp.MustCompile(`^E\d+:`)
-)
+// The default number of non-error messages in Error.Context.
+const histContextLines = 3
 
 type histState int
 
@@ -38,9 +57,18 @@ const (
 	histDetecting
 	histLine
 	histErrmsg
+	histTraceback
+	histIface
 )
 
 // Histerrs parses given message history and returns all errors. :h :message
+// The messages translated by :language messages are detected automatically.
+// Compile errors of Vim9 def functions, Lua errors with stack traceback of
+// Neovim and tracebacks of Python, Ruby and Perl interfaces are also parsed.
+// Ruby and Perl errors are detected only in Vim script error. Warnings like
+// W10 and the messages of plugins with the name in brackets outside of
+// "Error detected while processing" are warning and info errors.
+// Histerrs is a wrapper of HisterrsScanner.
 // Example(msghist):
 //   Error detected while processing function Main[2]..<SNR>96_test[1]..<SNR>96_test2[1]..F:
 //   line    3:
@@ -52,86 +80,492 @@ const (
 //   Error detected while processing /path/to/file.vim:
 //   line   33:
 //   E605: Exception not caught: 0
+//   E5108: Error executing lua /path/to/foo.lua:3: attempt to index a nil value
+//   stack traceback:
+//           /path/to/foo.lua:3: in function 'bar'
+//           [string ":lua"]:1: in main chunk
 //
 // vimdoc:func:
 //	stacktrace#histerrs([{string}])	*stacktrace#histerrs()*
 //		Parses message history and returns list of error |stacktrace-type-error|.
-//		|:message| content is used by default.
+//		|:message| content is used by default. The messages translated by
+//		|:language| are also supported. Compile errors of |Vim9| :def functions,
+//		Lua errors of Neovim and tracebacks of |python3|, |ruby| and |perl|
+//		interfaces are included. Warnings like "W10:" and the messages of
+//		plugins with the name in brackets, e.g. "[ALE] ...", outside of
+//		"Error detected while processing" are included as "warning" and
+//		"info". The other messages are the context of the next error. The root
+//		cause |stacktrace-type-cause| of each error is analyzed.
 func Histerrs(msghist string) []*Error {
 	var errors []*Error
-	e := &Error{}
-	state := histDefault
-	basethrowpoint := ""
-
-	reset := func() {
-		e = &Error{}
-		basethrowpoint = ""
-		state = histDefault
-	}
-
-	push := func() {
-		errors = append(errors, e)
-		reset()
-	}
-
-	// (reset) for invalid move
-	//
-	//                      +----<<<----(push)----<<<----+
-	//                      |                            |
-	//                      |             +-<-(push)-<-+ |
-	//                      |             |            | |
-	// histDefault -> histDetecting -> histLine -> histErrmsg
-	//  | |     |                                   |     | |
-	//  | +->>>-+                                   +->>>-+ |
-	//  |                                                   |
-	//  +----------<<<-------(push)--------------<<<<-------+
-
-	// append empty line to make sure to push the last error.
-	lines := append(strings.Split(msghist, "\n"), "")
-	for _, line := range lines {
-		switch state {
-		case histDefault:
-			if strings.HasPrefix(line, detectedLinePrefix) {
-				state = histDetecting
-				basethrowpoint = line[len(detectedLinePrefix) : len(line)-1]
-			}
-		case histDetecting:
-			ms := histerrsLineRegex.FindStringSubmatch(line)
-			if len(ms) == 2 {
-				state = histLine
-				e.Throwpoint = fmt.Sprintf("%s[%s]", basethrowpoint, ms[1])
-			} else {
-				reset()
-			}
-		case histLine:
-			if histerrsErrRegex.MatchString(line) {
-				state = histErrmsg
-				e.Messages = append(e.Messages, line)
-			} else {
-				reset()
+	s := NewHisterrsScanner(strings.NewReader(msghist))
+	for s.Scan() {
+		errors = append(errors, s.Histerr())
+	}
+	return errors
+}
+
+// HisterrsToken is the resume token of HisterrsScanner to scan the errors
+// newer than the previous scan.
+type HisterrsToken struct {
+	// Byte offset of the input after the error. It's used to resume the input
+	// which is only appended, e.g. log file, by seeking it.
+	Offset int64 `json:"offset"`
+
+	// The number of lines before Offset to keep the line numbers of the
+	// errors after resuming by Offset.
+	Lnum int `json:"lnum"`
+
+	// Hash of the location and the messages of the error. Unlike
+	// Error.Fingerprint, it's different for each call of lambda. It's used to
+	// resume the input which drops old messages, e.g. :messages, by skipping
+	// the errors until the same error.
+	Fingerprint string `json:"fingerprint"`
+
+	// The number of the errors with Fingerprint from the start of the scan to
+	// the error. The same error may occur again after other errors.
+	Count int `json:"count"`
+
+	// "Error detected while processing" line if the next error after Offset
+	// may continue the same context with "line N:". It's followed by the
+	// "line N:" line if the next error may be another traceback of the same
+	// line.
+	Header string `json:"header,omitempty"`
+}
+
+// HisterrsScanner scans the errors in message history from io.Reader. The
+// errors are yielded as they're found without reading the whole input.
+//
+//	s := NewHisterrsScanner(r)
+//	for s.Scan() {
+//		e, token := s.Histerr(), s.Token()
+//	}
+//	if err := s.Err(); err != nil {
+//	}
+type HisterrsScanner struct {
+	// The number of non-error messages kept in Error.Context.
+	ContextLines int
+
+	src io.Reader
+	r   *bufio.Reader
+	err error
+	eof bool
+
+	// byte offset of the next line
+	offset int64
+	// the line number and the byte offset of the line being fed
+	lnum       int
+	lineOffset int64
+	// the last non-error messages after the last error
+	recent []string
+	// the number of the errors by fingerprint
+	seen map[string]int
+
+	// errors found but not yielded yet and their tokens
+	found  []*Error
+	tokens []HisterrsToken
+
+	// the current yielded error
+	cur      *Error
+	curToken HisterrsToken
+
+	// the last error of the previous scan to resume by fingerprint. The errors
+	// after the last found one are held in skipped until it's found count
+	// times, to yield them at the end of the input if it isn't.
+	after      string
+	afterCount int
+	skipped    []*Error
+	skipTok    []HisterrsToken
+
+	// state of the current error
+	e              *Error
+	state          histState
+	header         string
+	lineHeader     string
+	basethrowpoint string
+	// the language of the current error message. :h :language
+	lang *msgLang
+	// lines of Lua stack traceback
+	traceback []string
+	// the interface and the lines of the current interface error
+	iface      *ifaceFormat
+	ifaceLines []string
+}
+
+// NewHisterrsScanner returns a new scanner to read from r.
+func NewHisterrsScanner(r io.Reader) *HisterrsScanner {
+	return &HisterrsScanner{
+		ContextLines: histContextLines,
+		src:          r,
+		r:            bufio.NewReader(r),
+		seen:         make(map[string]int),
+		e:            &Error{},
+		lang:         msgLangs[0],
+	}
+}
+
+// Resume makes s scan only the errors newer than the token of the previous
+// scan. It must be called before Scan. If r is io.Seeker and token has
+// Offset, r is read from the offset. Otherwise, r is read from the start and
+// the errors until the Count-th one with token's fingerprint are skipped. If
+// it's found fewer times, e.g. the old messages are dropped from :messages,
+// the errors after the last found one are new. All errors are new if the
+// fingerprint isn't found.
+func (s *HisterrsScanner) Resume(token HisterrsToken) error {
+	if seeker, ok := s.src.(io.Seeker); ok && token.Offset > 0 {
+		if _, err := seeker.Seek(token.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		s.r.Reset(s.src)
+		s.offset, s.lnum = token.Offset, token.Lnum
+		if token.Header != "" {
+			s.lineOffset = token.Offset
+			for _, line := range strings.Split(token.Header, "\n") {
+				s.feed(line)
 			}
-		case histErrmsg:
-			if histerrsErrRegex.MatchString(line) {
-				e.Messages = append(e.Messages, line)
-				continue
+			// the error starts at the next line.
+			s.e.Lnum = 0
+		}
+		return nil
+	}
+	s.after, s.afterCount = token.Fingerprint, token.Count
+	return nil
+}
+
+// Scan advances s to the next error, which is available by Histerr. It
+// returns false at the end of the input or an error.
+func (s *HisterrsScanner) Scan() bool {
+	for len(s.found) == 0 {
+		if s.eof || s.err != nil {
+			return false
+		}
+		s.readLine()
+	}
+	s.cur, s.curToken = s.found[0], s.tokens[0]
+	s.found, s.tokens = s.found[1:], s.tokens[1:]
+	return true
+}
+
+// Histerr returns the error found by Scan.
+func (s *HisterrsScanner) Histerr() *Error {
+	return s.cur
+}
+
+// Token returns the resume token to scan the errors after the error found by
+// Scan.
+func (s *HisterrsScanner) Token() HisterrsToken {
+	return s.curToken
+}
+
+// Err returns the first error of reading the input except io.EOF.
+func (s *HisterrsScanner) Err() error {
+	return s.err
+}
+
+// readLine reads a line and feeds it to the state machine.
+func (s *HisterrsScanner) readLine() {
+	line, err := s.r.ReadString('\n')
+	s.lineOffset = s.offset
+	s.offset += int64(len(line))
+	if err != nil && err != io.EOF {
+		s.err = err
+		return
+	}
+	if line != "" {
+		s.lnum++
+		s.feed(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+	}
+	if err == io.EOF {
+		// feed empty line to make sure to push the last error.
+		s.lineOffset = s.offset
+		s.lnum++
+		s.feed("")
+		s.eof = true
+		s.flushSkipped()
+	}
+}
+
+func (s *HisterrsScanner) reset() {
+	s.e = &Error{}
+	s.header = ""
+	s.lineHeader = ""
+	s.basethrowpoint = ""
+	s.traceback = nil
+	s.iface, s.ifaceLines = nil, nil
+	s.state = histDefault
+}
+
+// push pushes the current error which ends before the line being fed. header
+// is the header of the context which the next error continues.
+func (s *HisterrsScanner) push(header string) {
+	e := s.e
+	// the plugin message is info by start().
+	if e.Severity != SeverityInfo {
+		e.Severity = msgsSeverity(e.Messages)
+	}
+	fp := e.resumeKey()
+	s.seen[fp]++
+	token := HisterrsToken{
+		Offset:      s.lineOffset,
+		Lnum:        s.lnum - 1,
+		Fingerprint: fp,
+		Count:       s.seen[fp],
+		Header:      header,
+	}
+	s.reset()
+	// the context of the next error starts after this error.
+	s.recent = nil
+	if s.after != "" {
+		if fp != s.after {
+			s.skipped = append(s.skipped, e)
+			s.skipTok = append(s.skipTok, token)
+			return
+		}
+		// the errors until the last seen error are old.
+		s.skipped, s.skipTok = nil, nil
+		if s.seen[fp] >= s.afterCount {
+			s.after = ""
+		}
+		return
+	}
+	s.found = append(s.found, e)
+	s.tokens = append(s.tokens, token)
+}
+
+// flushSkipped yields the errors held to resume at the end of the input. They
+// are the errors after the last found error if it's found fewer times than the
+// token's count, or all errors if it isn't found.
+func (s *HisterrsScanner) flushSkipped() {
+	s.found = append(s.found, s.skipped...)
+	s.tokens = append(s.tokens, s.skipTok...)
+	s.skipped, s.skipTok = nil, nil
+	s.after = ""
+}
+
+// setThrowpoint sets normalized throwpoint with the line number to the
+// current error.
+func (s *HisterrsScanner) setThrowpoint(lnum string) bool {
+	tp, err := ParseThrowpoint(fmt.Sprintf("%s[%s]", s.basethrowpoint, lnum))
+	if err != nil {
+		return false
+	}
+	s.e.Throwpoint = tp.String()
+	return true
+}
+
+// setAutocmdThrowpoint sets throwpoint without the line number to the current
+// error. The error in autocommand itself doesn't have "line N:".
+func (s *HisterrsScanner) setAutocmdThrowpoint() bool {
+	tp, err := ParseThrowpoint(s.basethrowpoint)
+	if err != nil || tp.Frames[len(tp.Frames)-1].Kind != FrameAutocmd {
+		return false
+	}
+	s.e.Throwpoint = tp.String()
+	return true
+}
+
+// (reset) for invalid move
+//
+//                      +----<<<----(push)----<<<----+
+//                      |                            |
+//                      |             +-<-(push)-<-+ |
+//                      |             |            | |
+// histDefault -> histDetecting -> histLine -> histErrmsg -> histTraceback
+//  | | | |   |       |              |          | | | | |          |  |
+//  | | | +->>+       +-->(autocmd)>-|--------->+ +>>-+ |          +>>+
+//  | | |                            |          |  ^    |          |
+//  | | +------->>>(lua)>>>----------|--------->+  |    |          |
+//  | |                              v             |    |          |
+//  | +->>>(python)>>>---------> histIface ->>>----+    |          |
+//  |                              |  ^                 |          |
+//  |                              +>>+                 |          |
+//  +----------<<<-------(push)--------------<<<<-------+---<<<----+
+
+// beginIface begins the interface error from the line.
+func (s *HisterrsScanner) beginIface(f *ifaceFormat, line string) {
+	s.state = histIface
+	s.iface, s.ifaceLines = f, []string{line}
+}
+
+// endIface ends the interface error and continues in histErrmsg state.
+func (s *HisterrsScanner) endIface() {
+	msgs, stacks := s.iface.parse(s.ifaceLines)
+	s.e.Messages = append(s.e.Messages, msgs...)
+	s.e.Traceback = stacks
+	s.state = histErrmsg
+	s.iface, s.ifaceLines = nil, nil
+}
+
+// detect starts the error from "Error detected while processing" line.
+func (s *HisterrsScanner) detect(line, tp string, lang *msgLang) {
+	s.state = histDetecting
+	s.header = line
+	s.basethrowpoint, s.lang = tp, lang
+}
+
+// start starts a new error from the line in histDefault state.
+func (s *HisterrsScanner) start(line string) {
+	if tp, l, ok := parseDetected(line); ok {
+		s.detect(line, tp, l)
+	} else if isLuaErr(line) || isNvimInvokeErr(line) {
+		s.state = histErrmsg
+		s.e.Messages = append(s.e.Messages, line)
+	} else if isPythonTraceback(line) {
+		s.beginIface(ifaceStart(line), line)
+	} else if histerrsWarnRegex.MatchString(line) {
+		// the warning outside of function or script, e.g. W10 of :edit.
+		s.state = histErrmsg
+		s.e.Messages = append(s.e.Messages, line)
+	} else if isPluginMsg(line) {
+		s.state = histErrmsg
+		s.e.Messages = append(s.e.Messages, line)
+		s.e.Severity = SeverityInfo
+	}
+}
+
+// feed feeds the line to the state machine and records the position and the
+// context of the error.
+func (s *HisterrsScanner) feed(line string) {
+	s.feedLine(line)
+	if s.state == histDefault {
+		if strings.TrimSpace(line) != "" && s.ContextLines > 0 {
+			s.recent = append(s.recent, line)
+			if len(s.recent) > s.ContextLines {
+				s.recent = s.recent[len(s.recent)-s.ContextLines:]
 			}
-			ms := histerrsLineRegex.FindStringSubmatch(line)
-			if len(ms) == 2 {
-				savebasethrowpoint := basethrowpoint
-				push()
-				basethrowpoint = savebasethrowpoint
-				state = histLine // after push()
-				e.Throwpoint = fmt.Sprintf("%s[%s]", basethrowpoint, ms[1])
-			} else if strings.HasPrefix(line, detectedLinePrefix) {
-				push()
-				state = histDetecting
-				basethrowpoint = line[len(detectedLinePrefix) : len(line)-1]
-			} else {
-				push()
+		}
+		return
+	}
+	if s.e.Lnum == 0 {
+		s.e.Lnum = s.lnum
+		if len(s.recent) > 0 {
+			s.e.Context = append([]string(nil), s.recent...)
+		}
+	}
+	s.e.EndLnum = s.lnum
+}
+
+// feedLine moves the state by the line.
+func (s *HisterrsScanner) feedLine(line string) {
+	if s.state == histIface {
+		ok, done := s.iface.next(line)
+		if ok {
+			s.ifaceLines = append(s.ifaceLines, line)
+		}
+		if ok && !done {
+			return
+		}
+		s.endIface()
+		if ok {
+			return
+		}
+	}
+	switch s.state {
+	case histDefault:
+		s.start(line)
+	case histDetecting:
+		if lnum, ok := s.lang.parseDetectedLine(line); ok && s.setThrowpoint(lnum) {
+			s.state = histLine
+			s.lineHeader = line
+		} else if isHistMsg(line) && s.setAutocmdThrowpoint() {
+			s.state = histErrmsg
+			s.e.Messages = append(s.e.Messages, line)
+		} else {
+			s.reset()
+		}
+	case histLine:
+		if isCodedMsg(line) || isNvimInvokeErr(line) {
+			s.state = histErrmsg
+			s.e.Messages = append(s.e.Messages, line)
+		} else if f := ifaceStart(line); f != nil {
+			s.beginIface(f, line)
+		} else if isHistMsg(line) {
+			// :echoerr message
+			s.state = histErrmsg
+			s.e.Messages = append(s.e.Messages, line)
+		} else {
+			s.reset()
+		}
+	case histErrmsg:
+		if isCodedMsg(line) && s.e.Severity != SeverityInfo {
+			s.e.Messages = append(s.e.Messages, line)
+			return
+		}
+		if line == luaTracebackHeader {
+			s.state = histTraceback
+			return
+		}
+		if f := ifaceStart(line); f != nil {
+			if s.e.Traceback != nil {
+				// another traceback in the same line.
+				header, lineHeader, basethrowpoint, throwpoint := s.header, s.lineHeader, s.basethrowpoint, s.e.Throwpoint
+				if lineHeader != "" {
+					s.push(header + "\n" + lineHeader)
+				} else {
+					s.push("")
+				}
+				s.header, s.lineHeader, s.basethrowpoint, s.e.Throwpoint = header, lineHeader, basethrowpoint, throwpoint
 			}
+			s.beginIface(f, line)
+			return
+		}
+		if lnum, ok := s.lang.parseDetectedLine(line); ok {
+			header, basethrowpoint := s.header, s.basethrowpoint
+			s.push(header)
+			s.header, s.basethrowpoint = header, basethrowpoint
+			s.state = histLine // after push()
+			s.lineHeader = line
+			s.setThrowpoint(lnum)
+		} else if tp, l, ok := parseDetected(line); ok {
+			s.push("")
+			s.detect(line, tp, l)
+		} else {
+			s.push("")
+			s.start(line)
 		}
+	case histTraceback:
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ") {
+			s.traceback = append(s.traceback, line)
+			return
+		}
+		s.e.Traceback = ParseLuaTraceback(s.traceback)
+		s.push("")
+		s.start(line)
 	}
-	return errors
+}
+
+// isHistMsg reports whether the line can be the message of the error. The
+// message of :echoerr doesn't have the number like E121.
+func isHistMsg(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return false
+	}
+	_, _, ok := parseDetected(line)
+	return !ok
+}
+
+// resumeKey returns the hash of the error to identify it in message history
+// for HisterrsToken.
+func (e *Error) resumeKey() string {
+	h := sha1.New()
+	fmt.Fprintln(h, e.location())
+	for _, msg := range e.Messages {
+		fmt.Fprintln(h, msg)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// location returns the throwpoint or the location of the innermost Lua frame
+// for Lua error.
+func (e *Error) location() string {
+	if e.Throwpoint != "" || len(e.Traceback) == 0 {
+		return e.Throwpoint
+	}
+	last := e.Traceback[len(e.Traceback)-1]
+	if last.Filename == "" {
+		return last.Text
+	}
+	return fmt.Sprintf("%s:%d", last.Filename, last.Lnum)
 }
 
 // Fromhist returns selected stacktrace from errors in message history.
@@ -140,6 +574,10 @@ func Histerrs(msghist string) []*Error {
 //	stacktrace#fromhist()	*stacktrace#fromhist()*
 //		Show error candidates from |message-history| and returns stacktrace of
 //		selected error |stacktrace-type-stacktrace|.
+//		The same errors, e.g. in a loop or |CursorMoved| autocmd, are shown
+//		once with the count and the last one is used. The root cause message
+//		|stacktrace-type-cause| comes first in the text, e.g. "E121" before
+//		"E15", or the error before "E171: Missing :endif".
 func (cli *Vim) Fromhist() (*Stacktrace, error) {
 	msghist, err := cli.callstrfunc("execute", ":message")
 	if err != nil {
@@ -149,32 +587,60 @@ func (cli *Vim) Fromhist() (*Stacktrace, error) {
 	if err != nil || selected == nil {
 		return nil, err
 	}
-	stacktrace, err := cli.Build(selected.Throwpoint)
-	if err != nil {
-		return nil, err
+	return cli.buildError(selected)
+}
+
+// buildError builds stacktrace of the error. The error messages are added to
+// the text of the last stack.
+func (cli *Vim) buildError(e *Error) (*Stacktrace, error) {
+	stacktrace := &Stacktrace{}
+	if e.Throwpoint != "" {
+		var err error
+		stacktrace, err = cli.Build(e.Throwpoint)
+		if err != nil {
+			return nil, err
+		}
 	}
+	// Lua and interfaces are called from the last frame of Vim script.
+	stacktrace.Stacks = append(stacktrace.Stacks, cli.buildTraceback(e.Traceback)...)
 	// Add error messages
 	if len(stacktrace.Stacks) > 0 {
 		last := stacktrace.Stacks[len(stacktrace.Stacks)-1]
-		last.Text = strings.Join(selected.Messages, ", ") + " : " + last.Text
+		last.Text = strings.Join(e.messages(), ", ") + " : " + last.Text
+		last.Type = e.Severity.qfType()
 	}
+	stacktrace.Context = e.Context
 	return stacktrace, nil
 }
 
-// selectError selectes error from msg, it may return nil.
+// candidate returns the line of the error for selectError. e.g.
+// F[3]: E121: Undefined variable: x (:messages 4-6, after "foo", "bar")
+func (e *Error) candidate() string {
+	s := fmt.Sprintf("%v: %v (:messages %d-%d", e.location(), strings.Join(e.Messages, ", "), e.Lnum, e.EndLnum)
+	if len(e.Context) > 0 {
+		quoted := make([]string, 0, len(e.Context))
+		for _, c := range e.Context {
+			quoted = append(quoted, strconv.Quote(c))
+		}
+		s += ", after " + strings.Join(quoted, ", ")
+	}
+	return s + ")"
+}
+
+// selectError selectes error from msg, it may return nil. The same errors are
+// shown once and the last one is selected.
 func (cli *Vim) selectError(msghist string) (*Error, error) {
-	histerrs := Histerrs(msghist)
+	groups := GroupErrors(histerrsAnalyzed(msghist))
 
-	if len(histerrs) == 0 {
+	if len(groups) == 0 {
 		return nil, nil
-	} else if len(histerrs) == 1 {
-		return histerrs[0], nil
+	} else if len(groups) == 1 {
+		return groups[0].Error, nil
 	}
 
-	candidates := make([]string, 0, len(histerrs))
-	for i, histerr := range histerrs {
-		s := fmt.Sprintf("%d. %v: %v", i+1, histerr.Throwpoint, strings.Join(histerr.Messages, ", "))
-		candidates = append(candidates, s)
+	candidates := make([]string, 0, len(groups))
+	for i, g := range groups {
+		candidates = append(candidates, fmt.Sprintf("%d. %s", i+1, g.candidate()))
 	}
 
 	j, err := inputlist(cli, candidates)
@@ -186,5 +652,5 @@ func (cli *Vim) selectError(msghist string) (*Error, error) {
 	} else if j < 0 || len(candidates) < j {
 		return nil, fmt.Errorf("selected invalid number: %v", j)
 	}
-	return histerrs[j-1], nil
+	return groups[j-1].Error, nil
 }
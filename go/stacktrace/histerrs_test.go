@@ -2,9 +2,11 @@ package stacktrace
 
 import (
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	vim "github.com/haya14busa/vim-go-client"
 )
@@ -64,6 +66,180 @@ E605: Exception not caught: 0
 		},
 		{
 			in: `
+Error detected while processing command line..script /path/to/file.vim[31]..function F:
+line    1:
+E121: Undefined variable: err1`,
+			want: []*Error{
+				{
+					Throwpoint: "command line..script /path/to/file.vim[31]..function F[1]",
+					Messages:   []string{"E121: Undefined variable: err1"},
+				},
+			},
+		},
+		{
+			in: `
+Error detected while processing BufWritePost Autocommands for "*.go"..function go#fmt#Format:
+line   12:
+E121: Undefined variable: err1
+Error detected while processing command line..script /path/to/file.vim[15]..User Autocommands for "Foo":
+E117: Unknown function: H2
+Error detected while processing function F:
+E117: Unknown function: H2`,
+			want: []*Error{
+				{
+					Throwpoint: `BufWritePost Autocommands for "*.go"..function go#fmt#Format[12]`,
+					Messages:   []string{"E121: Undefined variable: err1"},
+				},
+				{
+					Throwpoint: `command line..script /path/to/file.vim[15]..User Autocommands for "Foo"`,
+					Messages:   []string{"E117: Unknown function: H2"},
+				},
+			},
+		},
+		{ // Lua error of Neovim
+			in: `
+E5108: Error executing lua /path/to/foo.lua:3: attempt to index a nil value
+stack traceback:
+	/path/to/foo.lua:3: in function 'bar'
+	[string ":lua"]:1: in main chunk
+Error detected while processing function F[2]..G:
+line    1:
+E5108: Error executing lua [string "luaeval()"]:1: err
+stack traceback:
+	[C]: in function 'error'
+	[string "luaeval()"]:1: in main chunk
+Error executing vim.schedule lua callback: /path/to/foo.lua:5: err`,
+			want: []*Error{
+				{
+					Messages: []string{"E5108: Error executing lua /path/to/foo.lua:3: attempt to index a nil value"},
+					Traceback: []*Stack{
+						{Kind: FrameLua, Text: `[string ":lua"]:1: main chunk`},
+						{Kind: FrameLua, Funcname: "bar", Filename: "/path/to/foo.lua", Lnum: 3, Text: "function 'bar'"},
+					},
+				},
+				{
+					Throwpoint: "function F[2]..G[1]",
+					Messages:   []string{`E5108: Error executing lua [string "luaeval()"]:1: err`},
+					Traceback: []*Stack{
+						{Kind: FrameLua, Text: `[string "luaeval()"]:1: main chunk`},
+					},
+				},
+				{Messages: []string{"Error executing vim.schedule lua callback: /path/to/foo.lua:5: err"}},
+			},
+		},
+		{ // Python, Ruby and Perl interfaces
+			in: `
+Error detected while processing function F[2]..G:
+line    1:
+Traceback (most recent call last):
+  File "<string>", line 1, in <module>
+  File "/path/to/foo.py", line 3, in bar
+    return 1 / 0
+ZeroDivisionError: division by zero
+Traceback (most recent call last):
+  File "<string>", line 1, in <module>
+NameError: name 'x' is not defined
+Error detected while processing function H:
+line    2:
+NameError: undefined local variable or method ` + "`foo' for main:Object" + `
+/path/to/foo.rb:3:in ` + "`bar'" + `
+line    3:
+Died at /path/to/foo.pl line 3.
+	main::bar() called at (eval 5) line 1
+Error invoking 'python_execute' on channel 3 (python3-script-host):
+Traceback (most recent call last):
+  File "/path/to/foo.py", line 5, in baz
+KeyError: 'k'`,
+			want: []*Error{
+				{
+					Throwpoint: "function F[2]..G[1]",
+					Messages:   []string{"ZeroDivisionError: division by zero"},
+					Traceback: []*Stack{
+						{Kind: FramePython, Funcname: "<module>", Text: "<string>:1: in <module>"},
+						{Kind: FramePython, Funcname: "bar", Filename: "/path/to/foo.py", Lnum: 3, Line: "return 1 / 0", Text: "in bar"},
+					},
+				},
+				{
+					Throwpoint: "function F[2]..G[1]",
+					Messages:   []string{"NameError: name 'x' is not defined"},
+					Traceback: []*Stack{
+						{Kind: FramePython, Funcname: "<module>", Text: "<string>:1: in <module>"},
+					},
+				},
+				{
+					Throwpoint: "function H[2]",
+					Messages:   []string{"NameError: undefined local variable or method `foo' for main:Object"},
+					Traceback: []*Stack{
+						{Kind: FrameRuby, Funcname: "bar", Filename: "/path/to/foo.rb", Lnum: 3, Text: "in bar"},
+					},
+				},
+				{
+					Throwpoint: "function H[3]",
+					Messages:   []string{"Died at /path/to/foo.pl line 3."},
+					Traceback: []*Stack{
+						{Kind: FramePerl, Funcname: "main", Text: "(eval 5):1: in main"},
+						{Kind: FramePerl, Funcname: "main::bar", Filename: "/path/to/foo.pl", Lnum: 3, Text: "in main::bar"},
+					},
+				},
+				{
+					Messages: []string{
+						"Error invoking 'python_execute' on channel 3 (python3-script-host):",
+						"KeyError: 'k'",
+					},
+					Traceback: []*Stack{
+						{Kind: FramePython, Funcname: "baz", Filename: "/path/to/foo.py", Lnum: 5, Text: "in baz"},
+					},
+				},
+			},
+		},
+		{ // Vim9 compile error
+			in: `
+Error detected while compiling command line..script /path/to/file.vim[8]..function <SNR>1_CallBroken[1]..<SNR>1_Broken:
+line    1:
+E1001: Variable not found: undefinedvar
+Error detected while processing command line:
+E1091: Function is not compiled: <SNR>1_CallBroken`,
+			want: []*Error{
+				{
+					Throwpoint: "command line..script /path/to/file.vim[8]..function <SNR>1_CallBroken[1]..<SNR>1_Broken[1]",
+					Messages:   []string{"E1001: Variable not found: undefinedvar"},
+				},
+			},
+		},
+		{ // :language messages ja_JP.UTF-8
+			in: `
+function Main[2]..F の処理中にエラーが検出されました:
+行    3:
+E121: 未定義の変数です: err1
+行    4:
+E121: 未定義の変数です: err2`,
+			want: []*Error{
+				{Throwpoint: "function Main[2]..F[3]", Messages: []string{"E121: 未定義の変数です: err1"}},
+				{Throwpoint: "function Main[2]..F[4]", Messages: []string{"E121: 未定義の変数です: err2"}},
+			},
+		},
+		{ // :language messages de_DE.UTF-8, fr_FR.UTF-8 and zh_CN.UTF-8
+			in: `
+Fehler beim Ausführen von "function F":
+Zeile    3:
+E121: Undefinierte Variable: err1
+Erreur détectée en traitant command line..script /path/to/file.vim[2]..Autocommandes User pour "Foo"..function G :
+ligne    1 :
+E121: Variable non définie : err1
+处理 /path/to/file.vim 时发生错误:
+第   33 行:
+E605: 异常没有被捕获: 0`,
+			want: []*Error{
+				{Throwpoint: "function F[3]", Messages: []string{"E121: Undefinierte Variable: err1"}},
+				{
+					Throwpoint: `command line..script /path/to/file.vim[2]..User Autocommands for "Foo"..function G[1]`,
+					Messages:   []string{"E121: Variable non définie : err1"},
+				},
+				{Throwpoint: "/path/to/file.vim[33]", Messages: []string{"E605: 异常没有被捕获: 0"}},
+			},
+		},
+		{
+			in: `
 ok1
 Error detected while processing function F1:
 line    3:
@@ -91,13 +267,65 @@ E121: errormsg
 			want: []*Error{
 				{Throwpoint: "function F1[3]", Messages: []string{"E121: errormsg"}},
 				{Throwpoint: "function F2[3]", Messages: []string{"E121: errormsg"}},
+				// "invalid" after "line N:" is the message of :echoerr.
+				{Throwpoint: "function G2[3]", Messages: []string{"invalid", "E121: errormsg"}},
 				{Throwpoint: "function F3[3]", Messages: []string{"E121: errormsg"}},
+				{Throwpoint: "function F3[4]", Messages: []string{"invalid", "E121: errormsg"}},
+			},
+		},
+		{ // :echoerr and warnings
+			in: `
+W99: standalone warning
+Error detected while processing function F:
+line    1:
+my plugin failed
+Error detected while processing function G:
+line    2:
+E121: Undefined variable: x
+W10: Warning: Changing a readonly file
+E15: Invalid expression: x
+Error detected while processing function H:
+line    3:
+W10: Warning: Changing a readonly file
+Error detected while processing BufRead Autocommands for "*":
+autocmd failed
+[myplugin] started
+plain message
+Error detected while processing function I:
+line    4:
+[myplugin] failed
+`,
+			want: []*Error{
+				{Messages: []string{"W99: standalone warning"}, Severity: SeverityWarning},
+				{Throwpoint: "function F[1]", Messages: []string{"my plugin failed"}},
+				{
+					Throwpoint: "function G[2]",
+					Messages: []string{
+						"E121: Undefined variable: x",
+						"W10: Warning: Changing a readonly file",
+						"E15: Invalid expression: x",
+					},
+				},
+				{
+					Throwpoint: "function H[3]",
+					Messages:   []string{"W10: Warning: Changing a readonly file"},
+					Severity:   SeverityWarning,
+				},
+				{Throwpoint: `BufRead Autocommands for "*"`, Messages: []string{"autocmd failed"}},
+				// the plugin message outside the error is info, but :echoerr
+				// is an error.
+				{Messages: []string{"[myplugin] started"}, Severity: SeverityInfo},
+				{Throwpoint: "function I[4]", Messages: []string{"[myplugin] failed"}},
 			},
 		},
 	}
 	v := &Vim{c: cli}
 	for _, tt := range tests {
 		got := Histerrs(tt.in)
+		// the positions and the context are tested in TestHisterrs_position.
+		for _, e := range got {
+			e.Lnum, e.EndLnum, e.Context = 0, 0, nil
+		}
 		if !reflect.DeepEqual(got, tt.want) {
 			t.Errorf("in:\n%v", tt.in)
 			t.Log("got:")
@@ -111,6 +339,9 @@ E121: errormsg
 		}
 		// check all throwpints are valid
 		for _, e := range got {
+			if e.Throwpoint == "" { // Lua error
+				continue
+			}
 			ss, err := v.Build(e.Throwpoint)
 			if err != nil {
 				t.Errorf("Error.Throwpoint (%v) is invalid: %v", e.Throwpoint, err)
@@ -122,6 +353,224 @@ E121: errormsg
 	}
 }
 
+func TestHisterrs_position(t *testing.T) {
+	msghist := `
+msg 1
+msg 2
+Error detected while processing function F:
+line    3:
+E121: Undefined variable: x
+E15: Invalid expression: x
+line    4:
+E121: Undefined variable: y
+msg 3
+msg 4
+msg 5
+msg 6
+E5108: Error executing lua [string ":lua"]:1: err
+stack traceback:
+	[C]: in function 'error'
+	[string ":lua"]:1: in main chunk`
+	want := []*Error{
+		{
+			Throwpoint: "function F[3]",
+			Messages:   []string{"E121: Undefined variable: x", "E15: Invalid expression: x"},
+			Lnum:       4,
+			EndLnum:    7,
+			Context:    []string{"msg 1", "msg 2"},
+		},
+		{
+			Throwpoint: "function F[4]",
+			Messages:   []string{"E121: Undefined variable: y"},
+			Lnum:       8,
+			EndLnum:    9,
+		},
+		{
+			Messages: []string{`E5108: Error executing lua [string ":lua"]:1: err`},
+			Lnum:     14,
+			EndLnum:  17,
+			Context:  []string{"msg 4", "msg 5", "msg 6"},
+		},
+	}
+	got := Histerrs(msghist)
+	for i := range got {
+		got[i].Traceback = nil
+	}
+	if !reflect.DeepEqual(got, want) {
+		for _, e := range got {
+			t.Logf("%#v", e)
+		}
+		t.Errorf("Histerrs() positions are wrong")
+	}
+
+	stacktrace, err := (&Vim{c: offlineClient{}}).buildError(got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stacktrace.Context, want[0].Context) {
+		t.Errorf("the context of stacktrace = %v, want %v", stacktrace.Context, want[0].Context)
+	}
+
+	// the line numbers are kept after resuming by offset.
+	s := NewHisterrsScanner(strings.NewReader(msghist))
+	s.Scan()
+	token := s.Token()
+	s = NewHisterrsScanner(strings.NewReader(msghist))
+	s.ContextLines = 0
+	if err := s.Resume(token); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Scan() {
+		t.Fatal("Scan() after resume = false")
+	}
+	if e := s.Histerr(); e.Lnum != 8 || e.EndLnum != 9 || e.Context != nil {
+		t.Errorf("resumed error = %#v", e)
+	}
+	if want := `function F[3]: E121: Undefined variable: x, E15: Invalid expression: x (:messages 4-7, after "msg 1", "msg 2")`; got[0].candidate() != want {
+		t.Errorf("candidate() = %q, want %q", got[0].candidate(), want)
+	}
+}
+
+// scanHisterrs scans r after token and returns the throwpoints and the last
+// token.
+func scanHisterrs(t *testing.T, r io.Reader, token *HisterrsToken) ([]string, HisterrsToken) {
+	t.Helper()
+	s := NewHisterrsScanner(r)
+	if token != nil {
+		if err := s.Resume(*token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tps []string
+	var last HisterrsToken
+	for s.Scan() {
+		tps = append(tps, s.Histerr().Throwpoint)
+		last = s.Token()
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return tps, last
+}
+
+func TestHisterrsScanner_Resume(t *testing.T) {
+	log := `Error detected while processing function F:
+line    3:
+E121: Undefined variable: x
+line    4:
+E121: Undefined variable: y
+`
+	tps, token := scanHisterrs(t, strings.NewReader(log), nil)
+	if want := []string{"function F[3]", "function F[4]"}; !reflect.DeepEqual(tps, want) {
+		t.Fatalf("scan = %v, want %v", tps, want)
+	}
+
+	// resume the appended log by offset.
+	s := NewHisterrsScanner(strings.NewReader(log))
+	s.Scan()
+	first := s.Token()
+	if first.Header == "" {
+		t.Errorf("token before line 4 should have the header: %#v", first)
+	}
+	if tps, _ := scanHisterrs(t, strings.NewReader(log), &first); !reflect.DeepEqual(tps, []string{"function F[4]"}) {
+		t.Errorf("resume from %#v = %v", first, tps)
+	}
+	log += `Error detected while processing function G:
+line    1:
+E121: Undefined variable: z
+`
+	if tps, _ := scanHisterrs(t, strings.NewReader(log), &token); !reflect.DeepEqual(tps, []string{"function G[1]"}) {
+		t.Errorf("resume from %#v = %v", token, tps)
+	}
+
+	// resume :messages which drops old messages by fingerprint.
+	msghist := `Error detected while processing function F:
+line    4:
+E121: Undefined variable: y
+Error detected while processing function G:
+line    1:
+E121: Undefined variable: z
+`
+	fp := HisterrsToken{Fingerprint: token.Fingerprint, Count: token.Count}
+	if tps, _ := scanHisterrs(t, struct{ io.Reader }{strings.NewReader(msghist)}, &fp); !reflect.DeepEqual(tps, []string{"function G[1]"}) {
+		t.Errorf("resume from %#v = %v", fp, tps)
+	}
+	// all errors are new if the last seen error is dropped.
+	unknown := HisterrsToken{Fingerprint: "unknown"}
+	if tps, _ := scanHisterrs(t, strings.NewReader(msghist), &unknown); len(tps) != 2 {
+		t.Errorf("resume from unknown fingerprint = %v", tps)
+	}
+}
+
+func TestHisterrsScanner_Resume_traceback(t *testing.T) {
+	log := `Error detected while processing function F[2]..G:
+line    1:
+Traceback (most recent call last):
+  File "<string>", line 1, in <module>
+ZeroDivisionError: division by zero
+Traceback (most recent call last):
+  File "<string>", line 1, in <module>
+NameError: name 'x' is not defined
+`
+	s := NewHisterrsScanner(strings.NewReader(log))
+	s.Scan()
+	first := s.Token()
+	// resume between the two tracebacks of the same line.
+	sr := NewHisterrsScanner(strings.NewReader(log))
+	if err := sr.Resume(first); err != nil {
+		t.Fatal(err)
+	}
+	if !sr.Scan() {
+		t.Fatalf("resume from %#v finds no error", first)
+	}
+	e := sr.Histerr()
+	if e.Throwpoint != "function F[2]..G[1]" || !reflect.DeepEqual(e.Messages, []string{"NameError: name 'x' is not defined"}) || e.Lnum != 6 {
+		t.Errorf("resume from %#v = %#v", first, e)
+	}
+	if sr.Scan() {
+		t.Errorf("resume from %#v finds another error %#v", first, sr.Histerr())
+	}
+}
+
+func TestHisterrsScanner_Resume_repeated(t *testing.T) {
+	x := "Error detected while processing function F:\nline    1:\nE121: Undefined variable: x\n"
+	y := "Error detected while processing function G:\nline    1:\nE121: Undefined variable: y\n"
+	z := "Error detected while processing function H:\nline    1:\nE121: Undefined variable: z\n"
+	// non-seekable reader to resume by fingerprint.
+	reader := func(s string) io.Reader { return struct{ io.Reader }{strings.NewReader(s)} }
+
+	s := NewHisterrsScanner(reader(x))
+	s.Scan()
+	first := s.Token()
+	if first.Count != 1 {
+		t.Errorf("the count of the first error = %d, want 1", first.Count)
+	}
+	tps, last := scanHisterrs(t, reader(x+y+x), &first)
+	if want := []string{"function G[1]", "function F[1]"}; !reflect.DeepEqual(tps, want) {
+		t.Errorf("resume X, Y, X from the first X = %v, want %v", tps, want)
+	}
+	if last.Count != 2 {
+		t.Errorf("the count of the last error = %d, want 2", last.Count)
+	}
+	if tps, _ := scanHisterrs(t, reader(x+y+x+z), &last); !reflect.DeepEqual(tps, []string{"function H[1]"}) {
+		t.Errorf("resume X, Y, X, Z from the last X = %v", tps)
+	}
+	// the first X is dropped from :messages.
+	if tps, _ := scanHisterrs(t, reader(y+x+z), &last); !reflect.DeepEqual(tps, []string{"function H[1]"}) {
+		t.Errorf("resume Y, X, Z from the last X = %v", tps)
+	}
+}
+
+func TestHisterrsScanner_Err(t *testing.T) {
+	s := NewHisterrsScanner(iotest.ErrReader(io.ErrUnexpectedEOF))
+	if s.Scan() {
+		t.Errorf("Scan() = true, want false")
+	}
+	if err := s.Err(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Err() = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
 func TestVimFromhist(t *testing.T) {
 	msghist := `
 Error detected while processing function Main[2]..<SNR>96_test[1]..<SNR>96_test2[1]..F:
@@ -136,7 +585,7 @@ E15: Invalid expression: err1
 	defer closer.Close()
 	v := &Vim{c: c}
 	for _, line := range strings.Split(msghist, "\n") {
-		v.c.Ex(fmt.Sprintf("echomsg '%v'", line))
+		c.Ex(fmt.Sprintf("echomsg '%v'", line))
 	}
 	got, err := v.Fromhist()
 	if err != nil {
@@ -245,3 +694,20 @@ E15: Invalid expression: err1
 		t.Errorf("Vim.selectError(...).Throwpoint = %v, want %v", got.Throwpoint, wantThrowpoint)
 	}
 }
+
+func TestError_location(t *testing.T) {
+	tests := []struct {
+		in   *Error
+		want string
+	}{
+		{in: &Error{Throwpoint: "function F[1]"}, want: "function F[1]"},
+		{in: &Error{Traceback: []*Stack{{Kind: FrameLua, Filename: "/path/to/foo.lua", Lnum: 3}}}, want: "/path/to/foo.lua:3"},
+		{in: &Error{Traceback: []*Stack{{Kind: FrameLua, Text: `[string ":lua"]:1: main chunk`}}}, want: `[string ":lua"]:1: main chunk`},
+		{in: &Error{}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.in.location(); got != tt.want {
+			t.Errorf("Error.location() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ifaceFormat represents the error format of a language interface such as
+// :python3, :ruby and :perl.
+type ifaceFormat struct {
+	kind FrameKind
+
+	// start reports whether the line starts the error.
+	start func(line string) bool
+
+	// next reports whether the line after the start is a part of the error.
+	// done is true if the line is the last one.
+	next func(line string) (ok, done bool)
+
+	// parse returns the error messages and the traceback in the order of
+	// Stacktrace from the lines of the error.
+	parse func(lines []string) ([]string, []*Stack)
+}
+
+var ifaceFormats = []*ifaceFormat{
+	{kind: FramePython, start: isPythonTraceback, next: nextPythonTraceback, parse: parsePythonTraceback},
+	{kind: FrameRuby, start: rubyErrRegex.MatchString, next: nextRubyBacktrace, parse: parseRubyBacktrace},
+	{kind: FramePerl, start: perlErrRegex.MatchString, next: nextPerlCalledAt, parse: parsePerlErr},
+}
+
+// ifaceStart returns the interface format whose error starts at the line.
+func ifaceStart(line string) *ifaceFormat {
+	for _, f := range ifaceFormats {
+		if f.start(line) {
+			return f
+		}
+	}
+	return nil
+}
+
+// isPseudoFile reports whether the filename in traceback isn't a real file.
+// e.g. [string ":lua"], <string>, (eval 5), -e
+func isPseudoFile(name string) bool {
+	return strings.HasPrefix(name, "[") || strings.HasPrefix(name, "<") ||
+		strings.HasPrefix(name, "(") || name == "eval" || name == "-e"
+}
+
+// newTracebackStack returns a stack of interface traceback. The location is
+// written in Text for pseudo file.
+func newTracebackStack(kind FrameKind, file string, lnum int, funcname string) *Stack {
+	e := &Stack{Kind: kind, Funcname: funcname, Text: "in " + funcname}
+	if isPseudoFile(file) {
+		e.Text = file + ":" + strconv.Itoa(lnum) + ": " + e.Text
+		return e
+	}
+	e.Filename = expandpath(file)
+	e.Lnum = lnum
+	return e
+}
+
+// Python :h python3
+// e.g.
+//
+//	Traceback (most recent call last):
+//	  File "<string>", line 1, in <module>
+//	  File "/path/to/foo.py", line 3, in bar
+//	    return 1 / 0
+//	           ~~^~~
+//	ZeroDivisionError: division by zero
+const pythonTracebackHeader = "Traceback (most recent call last):"
+
+var (
+	pythonFileRegex   = regexp.MustCompile(`^  File "(.+)", line (\d+), in (.+)$`)
+	pythonMarkerRegex = regexp.MustCompile(`^\s*[~^]+\s*$`)
+)
+
+func isPythonTraceback(line string) bool {
+	return line == pythonTracebackHeader
+}
+
+func nextPythonTraceback(line string) (ok, done bool) {
+	if strings.HasPrefix(line, " ") {
+		return true, false
+	}
+	// the exception message
+	return line != "", true
+}
+
+func parsePythonTraceback(lines []string) ([]string, []*Stack) {
+	var (
+		msgs   []string
+		stacks []*Stack
+	)
+	for _, line := range lines[1:] {
+		if m := pythonFileRegex.FindStringSubmatch(line); m != nil {
+			lnum, _ := strconv.Atoi(m[2])
+			stacks = append(stacks, newTracebackStack(FramePython, m[1], lnum, m[3]))
+			continue
+		}
+		switch {
+		case pythonMarkerRegex.MatchString(line):
+		case strings.HasPrefix(line, "    "):
+			if len(stacks) > 0 && stacks[len(stacks)-1].Line == "" {
+				stacks[len(stacks)-1].Line = line[len("    "):]
+			}
+		case !strings.HasPrefix(line, " "):
+			msgs = append(msgs, line)
+		}
+	}
+	return msgs, stacks
+}
+
+// Ruby :h ruby
+// e.g.
+//
+//	NameError: undefined local variable or method `foo' for main:Object
+//	/path/to/foo.rb:3:in `bar'
+//	eval:1:in `<main>'
+var (
+	rubyErrRegex       = regexp.MustCompile(`^[A-Z]\w*(?:::[A-Z]\w*)*(?:Error|Exception): `)
+	rubyBacktraceRegex = regexp.MustCompile("^(.+?):(\\d+):in [`'](.+)'$")
+)
+
+func nextRubyBacktrace(line string) (ok, done bool) {
+	return rubyBacktraceRegex.MatchString(line), false
+}
+
+func parseRubyBacktrace(lines []string) ([]string, []*Stack) {
+	var stacks []*Stack
+	for _, line := range lines[1:] {
+		m := rubyBacktraceRegex.FindStringSubmatch(line)
+		lnum, _ := strconv.Atoi(m[2])
+		// backtrace is the innermost first.
+		stacks = append([]*Stack{newTracebackStack(FrameRuby, m[1], lnum, m[3])}, stacks...)
+	}
+	return lines[:1], stacks
+}
+
+// Perl :h perl
+// e.g.
+//
+//	Illegal division by zero at /path/to/foo.pl line 3.
+//		main::bar() called at /path/to/foo.pl line 7
+var (
+	perlErrRegex      = regexp.MustCompile(`^.+ at (.+) line (\d+)\.$`)
+	perlCalledAtRegex = regexp.MustCompile(`^\t(.+) called at (.+) line (\d+)$`)
+)
+
+func nextPerlCalledAt(line string) (ok, done bool) {
+	return perlCalledAtRegex.MatchString(line), false
+}
+
+func parsePerlErr(lines []string) ([]string, []*Stack) {
+	m := perlErrRegex.FindStringSubmatch(lines[0])
+	file, lnum := m[1], m[2]
+	var stacks []*Stack
+	for _, line := range lines[1:] {
+		c := perlCalledAtRegex.FindStringSubmatch(line)
+		// the sub called at the line is the function of the previous location.
+		l, _ := strconv.Atoi(lnum)
+		stacks = append([]*Stack{newTracebackStack(FramePerl, file, l, strings.TrimSuffix(c[1], "()"))}, stacks...)
+		file, lnum = c[2], c[3]
+	}
+	l, _ := strconv.Atoi(lnum)
+	stacks = append([]*Stack{newTracebackStack(FramePerl, file, l, "main")}, stacks...)
+	return lines[:1], stacks
+}
+
+// buildTraceback fills the line text of traceback stacks from the files.
+func (cli *Vim) buildTraceback(stacks []*Stack) []*Stack {
+	es := make([]*Stack, 0, len(stacks))
+	for _, s := range stacks {
+		e := *s
+		if e.Line == "" && e.Filename != "" && e.Lnum > 0 {
+			f := cli.buildFileStack(e.Filename, e.Lnum)
+			e.Line, e.Status, e.Error = f.Line, f.Status, f.Error
+		}
+		if e.Line != "" {
+			e.Text += ": " + strings.TrimSpace(e.Line)
+		}
+		es = append(es, &e)
+	}
+	return es
+}
+
+// Neovim's error of remote plugin such as Python.
+// e.g. Error invoking 'python_execute' on channel 3 (python3-script-host):
+var nvimInvokeErrRegex = regexp.MustCompile(`^Error invoking '.+' on channel \d+`)
+
+func isNvimInvokeErr(line string) bool {
+	return nvimInvokeErrRegex.MatchString(line)
+}
@@ -0,0 +1,116 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIfaceFormats(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantKind  FrameKind
+		wantMsgs  []string
+		wantStack []*Stack
+	}{
+		{
+			in: `Traceback (most recent call last):
+  File "<string>", line 1, in <module>
+  File "/path/to/foo.py", line 3, in bar
+    return 1 / 0
+           ~~^~~
+ZeroDivisionError: division by zero`,
+			wantKind: FramePython,
+			wantMsgs: []string{"ZeroDivisionError: division by zero"},
+			wantStack: []*Stack{
+				{Kind: FramePython, Funcname: "<module>", Text: "<string>:1: in <module>"},
+				{Kind: FramePython, Funcname: "bar", Filename: "/path/to/foo.py", Lnum: 3, Line: "return 1 / 0", Text: "in bar"},
+			},
+		},
+		{
+			in: "NameError: undefined local variable or method `foo' for main:Object\n" +
+				"/path/to/foo.rb:3:in `bar'\n" +
+				"/path/to/foo.rb:7:in 'Foo#baz'\n" +
+				"eval:1:in `<main>'",
+			wantKind: FrameRuby,
+			wantMsgs: []string{"NameError: undefined local variable or method `foo' for main:Object"},
+			wantStack: []*Stack{
+				{Kind: FrameRuby, Funcname: "<main>", Text: "eval:1: in <main>"},
+				{Kind: FrameRuby, Funcname: "Foo#baz", Filename: "/path/to/foo.rb", Lnum: 7, Text: "in Foo#baz"},
+				{Kind: FrameRuby, Funcname: "bar", Filename: "/path/to/foo.rb", Lnum: 3, Text: "in bar"},
+			},
+		},
+		{
+			in: "Illegal division by zero at /path/to/foo.pl line 3.\n" +
+				"\tmain::bar() called at /path/to/foo.pl line 7\n" +
+				"\tmain::foo() called at (eval 5) line 1",
+			wantKind: FramePerl,
+			wantMsgs: []string{"Illegal division by zero at /path/to/foo.pl line 3."},
+			wantStack: []*Stack{
+				{Kind: FramePerl, Funcname: "main", Text: "(eval 5):1: in main"},
+				{Kind: FramePerl, Funcname: "main::foo", Filename: "/path/to/foo.pl", Lnum: 7, Text: "in main::foo"},
+				{Kind: FramePerl, Funcname: "main::bar", Filename: "/path/to/foo.pl", Lnum: 3, Text: "in main::bar"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		lines := strings.Split(tt.in, "\n")
+		f := ifaceStart(lines[0])
+		if f == nil || f.kind != tt.wantKind {
+			t.Errorf("ifaceStart(%q) = %v, want %v", lines[0], f, tt.wantKind)
+			continue
+		}
+		for i, line := range lines[1:] {
+			ok, done := f.next(line)
+			if !ok || done != (i == len(lines)-2 && f.kind == FramePython) {
+				t.Errorf("%v: next(%q) = (%v, %v)", f.kind, line, ok, done)
+			}
+		}
+		msgs, stacks := f.parse(lines)
+		if !reflect.DeepEqual(msgs, tt.wantMsgs) {
+			t.Errorf("%v: parse() messages = %q, want %q", f.kind, msgs, tt.wantMsgs)
+		}
+		if !reflect.DeepEqual(stacks, tt.wantStack) {
+			for _, e := range stacks {
+				t.Errorf("%v: got : %#v", f.kind, e)
+			}
+			for _, e := range tt.wantStack {
+				t.Errorf("%v: want: %#v", f.kind, e)
+			}
+		}
+	}
+	for _, line := range []string{"E121: Undefined variable: x", "line    3:", "Error detected while processing function F:"} {
+		if f := ifaceStart(line); f != nil {
+			t.Errorf("ifaceStart(%q) = %v, want nil", line, f.kind)
+		}
+	}
+}
+
+func TestVim_buildTraceback(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	defer os.Remove(tmp.Name())
+	tmp.WriteString("def baz():\n    return 1 / 0\n")
+	filename := tmp.Name()
+
+	v := &Vim{c: cli}
+	in := []*Stack{
+		// the line in the traceback is used as is.
+		{Kind: FramePython, Funcname: "baz", Filename: filename, Lnum: 2, Line: "return 1 / 0", Text: "in baz"},
+		{Kind: FrameRuby, Funcname: "bar", Filename: filename, Lnum: 1, Text: "in bar"},
+	}
+	want := []*Stack{
+		{Kind: FramePython, Funcname: "baz", Filename: filename, Lnum: 2, Line: "return 1 / 0", Text: "in baz: return 1 / 0"},
+		{Kind: FrameRuby, Funcname: "bar", Filename: filename, Lnum: 1, Line: "def baz():", Text: "in bar: def baz():"},
+	}
+	if got := v.buildTraceback(in); !reflect.DeepEqual(got, want) {
+		for _, e := range got {
+			t.Errorf("got : %#v", e)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package stacktrace
+
+import (
+	"strings"
+)
+
+// lambdaDef represents a lambda expression in a Vim script file.
+type lambdaDef struct {
+	lnum int
+	col  int
+	// The line number of the function which contains the lambda. It's 0 for
+	// the lambda at the top level.
+	funcLnum int
+}
+
+// lookupLambda returns the line number of the lambda called from callerLnum
+// in the function defined at callerFuncLnum. body is the lambda body from
+// :function listing, which may be empty because lambda is freed after call.
+// It returns 0 if not found.
+func (idx *funcIndex) lookupLambda(callerFuncLnum, callerLnum int, body string) int {
+	var candidates []*lambdaDef
+	for _, d := range idx.lambdas {
+		if d.funcLnum == callerFuncLnum {
+			candidates = append(candidates, d)
+		}
+	}
+	// e.g. "return s:test()" for {-> s:test()}
+	if expr := strings.TrimPrefix(strings.TrimSpace(body), "return "); expr != "" {
+		var matched []*lambdaDef
+		for _, d := range candidates {
+			if idx.lambdaContains(d, expr) {
+				matched = append(matched, d)
+			}
+		}
+		candidates = matched
+	}
+	if len(candidates) == 0 {
+		return 0
+	}
+	// the nearest lambda defined before the call.
+	found := candidates[0]
+	for _, d := range candidates[1:] {
+		if d.lnum <= callerLnum {
+			found = d
+		}
+	}
+	return found.lnum
+}
+
+// lambdaContains reports whether the source of lambda d contains expr.
+func (idx *funcIndex) lambdaContains(d *lambdaDef, expr string) bool {
+	if d.lnum < 1 || len(idx.lines) < d.lnum {
+		return false
+	}
+	line := idx.lines[d.lnum-1]
+	if 0 < d.col && d.col <= len(line) {
+		line = line[d.col-1:]
+	}
+	return strings.Contains(line, expr)
+}
+
+// resolveLambda resolves the definition of lambda stack e from the caller
+// stack. The lambda is usually defined in the caller function or script.
+func (cli *Vim) resolveLambda(e, caller *Stack) {
+	if caller.Filename == "" || caller.Lnum == 0 {
+		return
+	}
+	callerFuncLnum := 0
+	if caller.Funcname != "" {
+		callerFuncLnum = caller.Lnum - caller.Flnum
+	}
+	idx := cli.funcIndex(caller.Filename)
+	if idx == nil {
+		return
+	}
+	lnum := idx.lookupLambda(callerFuncLnum, caller.Lnum, e.Line)
+	if lnum == 0 {
+		return
+	}
+	e.setLocation(caller.Filename, lnum+e.Flnum-1, idx.lines)
+}
@@ -0,0 +1,107 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFuncIndex_lookupLambda(t *testing.T) {
+	idx := &funcIndex{
+		lines: []string{
+			"let s:F = {-> 1}",
+			"function! F() abort",
+			"  let l:G = {x -> x + 1}",
+			"  call l:G(1)",
+			"  let l:H = {-> s:test()}",
+			"  return l:H()",
+			"endfunction",
+		},
+		lambdas: []*lambdaDef{
+			{lnum: 1, col: 10},
+			{lnum: 3, col: 13, funcLnum: 2},
+			{lnum: 5, col: 13, funcLnum: 2},
+		},
+	}
+	tests := []struct {
+		callerFuncLnum, callerLnum int
+		body                       string
+		want                       int
+	}{
+		{callerFuncLnum: 0, callerLnum: 10, want: 1},
+		{callerFuncLnum: 2, callerLnum: 4, want: 3},
+		{callerFuncLnum: 2, callerLnum: 6, want: 5},
+		{callerFuncLnum: 2, callerLnum: 6, body: "return x + 1", want: 3},
+		{callerFuncLnum: 2, callerLnum: 4, body: "return s:test()", want: 5},
+		{callerFuncLnum: 2, callerLnum: 4, body: "return notfound", want: 0},
+		{callerFuncLnum: 100, callerLnum: 104, want: 0},
+	}
+	for _, tt := range tests {
+		if got := idx.lookupLambda(tt.callerFuncLnum, tt.callerLnum, tt.body); got != tt.want {
+			t.Errorf("funcIndex.lookupLambda(%v, %v, %q) = %v, want %v", tt.callerFuncLnum, tt.callerLnum, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestVim_resolveLambda(t *testing.T) {
+	scripts := `
+let s:F = {-> s:test()}
+function! F() abort
+  let l:G = {-> s:test()}
+  return l:G()
+endfunction
+`
+	tmp, _ := ioutil.TempFile("", "vim-stacktrace-test")
+	defer tmp.Close()
+	defer os.Remove(tmp.Name())
+	tmp.WriteString(scripts)
+	filename := tmp.Name()
+
+	v := &Vim{c: cli}
+	tests := []struct {
+		caller *Stack
+		want   *Stack
+	}{
+		{
+			caller: &Stack{Funcname: "F", Flnum: 2, Filename: filename, Lnum: 5},
+			want: &Stack{
+				Kind:     FrameLambda,
+				Funcname: "<lambda>1",
+				Flnum:    1,
+				Line:     "  let l:G = {-> s:test()}",
+				Filename: filename,
+				Lnum:     4,
+				Text:     "<lambda>1:1:  let l:G = {-> s:test()}",
+			},
+		},
+		{
+			caller: &Stack{Kind: FrameScript, Filename: filename, Lnum: 2},
+			want: &Stack{
+				Kind:     FrameLambda,
+				Funcname: "<lambda>1",
+				Flnum:    1,
+				Line:     "let s:F = {-> s:test()}",
+				Filename: filename,
+				Lnum:     2,
+				Text:     "<lambda>1:1:let s:F = {-> s:test()}",
+			},
+		},
+		{
+			caller: &Stack{Funcname: "F", Flnum: 2},
+			want: &Stack{
+				Kind:     FrameLambda,
+				Funcname: "<lambda>1",
+				Flnum:    1,
+				Text:     "<lambda>1:1:",
+			},
+		},
+	}
+	for _, tt := range tests {
+		e := &Stack{Kind: FrameLambda, Funcname: "<lambda>1", Flnum: 1, Text: "<lambda>1:1:"}
+		v.resolveLambda(e, tt.caller)
+		if !reflect.DeepEqual(e, tt.want) {
+			t.Errorf("Vim.resolveLambda(_, %v)\ngot:  %#v\nwant: %#v", tt.caller, e, tt.want)
+		}
+	}
+}
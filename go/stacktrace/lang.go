@@ -0,0 +1,253 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strings"
+)
+
+// msgFormat represents Vim's messages translated by :language messages.
+// Empty field means the message isn't translated. The messages are taken from
+// Vim's po files (src/po/*.po).
+type msgFormat struct {
+	lang string
+
+	// _("Error detected while processing %s:")
+	detected string
+	// _("Error detected while compiling %s:") for Vim9 def function
+	compiling string
+	// _("line %4ld:")
+	line string
+	// _("%s, line %ld") for v:throwpoint
+	throwpointLine string
+	// _("\n\tLast set from ") for :verbose
+	lastSet string
+	// _(" line ") after "Last set from"
+	lastSetLine string
+	// _("%s Autocommands for \"%s\"")
+	autocmd string
+}
+
+var msgFormats = []*msgFormat{
+	{
+		lang:           "en",
+		detected:       "Error detected while processing %s:",
+		compiling:      "Error detected while compiling %s:",
+		line:           "line %4ld:",
+		throwpointLine: "%s, line %ld",
+		lastSet:        "\n\tLast set from ",
+		lastSetLine:    " line ",
+		autocmd:        "%s Autocommands for \"%s\"",
+	},
+	{
+		lang:           "de",
+		detected:       "Fehler beim Ausführen von \"%s\":",
+		compiling:      "Fehler beim Ausführen von %s:",
+		line:           "Zeile %4ld:",
+		throwpointLine: "%s, Zeile %ld",
+		lastSet:        "\n\tZuletzt gesetzt in ",
+		lastSetLine:    " Zeile ",
+		autocmd:        "%s Autokommandos für \"%s\"",
+	},
+	{
+		lang:           "es",
+		detected:       "Se ha detectado un error al procesar %s:",
+		compiling:      "Se ha detectado un error al compilar %s:",
+		line:           "línea %4ld:",
+		throwpointLine: "%s, línea %ld",
+		lastSet:        "\n\tSe definió por última vez en ",
+		lastSetLine:    " línea ",
+		autocmd:        "%s Auto-órdenes para \"%s\"",
+	},
+	{
+		lang:           "fr",
+		detected:       "Erreur détectée en traitant %s :",
+		compiling:      "Erreur détectée lors de la compilation %s",
+		line:           "ligne %4ld :",
+		throwpointLine: "%s, ligne %ld",
+		lastSet:        "\n\tModifié la dernière fois dans ",
+		lastSetLine:    " ligne ",
+		autocmd:        "Autocommandes %s pour \"%s\"",
+	},
+	{
+		lang:           "it",
+		detected:       "Trovato errore eseguendo %s:",
+		compiling:      "Trovato errore compilando %s:",
+		line:           "riga %4ld:",
+		throwpointLine: "%s, riga %ld",
+		lastSet:        "\n\tImpostata l'ultima volta da ",
+		lastSetLine:    " riga ",
+		autocmd:        "%s Autocomandi per \"%s\"",
+	},
+	{
+		lang:           "ja",
+		detected:       "%s の処理中にエラーが検出されました:",
+		compiling:      "%s のコンパイル中にエラーが検出されました:",
+		line:           "行 %4ld:",
+		throwpointLine: "%s, 行 %ld",
+		lastSet:        "\n\t最後にセットしたスクリプト: ",
+		lastSetLine:    " 行 ",
+	},
+	{
+		lang:           "ko",
+		detected:       "%s 수행중 에러 발견:",
+		line:           "%4ld 줄:",
+		throwpointLine: "%s, %ld 줄",
+	},
+	{
+		lang:           "pt_BR",
+		detected:       "Erro detectado ao processar %s:",
+		line:           "linha %4ld:",
+		throwpointLine: "%s, linha %ld",
+		lastSet:        "\n\tDefinido pela última vez em ",
+		autocmd:        "Comandos automáticos %s para \"%s\"",
+	},
+	{
+		lang:           "ru",
+		detected:       "Обнаружена ошибка при обработке %s:",
+		compiling:      "Обнаружена ошибка при компиляции %s:",
+		line:           "строка %4ld:",
+		throwpointLine: "%s, строка %ld",
+		lastSet:        "\n\tПоследний раз установлено на ",
+		lastSetLine:    " строке ",
+		autocmd:        "%s автокоманда для шаблона \"%s\"",
+	},
+	{
+		lang:           "zh_CN",
+		detected:       "处理 %s 时发生错误:",
+		compiling:      "编译 %s 时发生错误：",
+		line:           "第 %4ld 行:",
+		throwpointLine: "%s，第 %ld 行",
+		lastSet:        "\n\t最近修改于 ",
+		lastSetLine:    " 行 ",
+		autocmd:        "%s 自动命令 \"%s\"",
+	},
+	{
+		lang:           "zh_TW",
+		detected:       "處理 %s 時發生錯誤:",
+		line:           "行 %4ld:",
+		throwpointLine: "%s, 行 %ld",
+		lastSet:        "\n\t上次設定: ",
+		autocmd:        "%s Autocommands: \"%s\"",
+	},
+}
+
+// msgLang holds regexps compiled from msgFormat. The regexps of untranslated
+// messages are nil.
+type msgLang struct {
+	*msgFormat
+
+	// captures "throwpoint"
+	detectedRegex *regexp.Regexp
+	// captures "throwpoint"
+	compilingRegex *regexp.Regexp
+	// captures "lnum"
+	lineRegex *regexp.Regexp
+	// captures "throwpoint" and "lnum"
+	throwpointLineRegex *regexp.Regexp
+	// captures "file" and "lnum"
+	lastSetRegex *regexp.Regexp
+	// captures "event". It matches autocmd frame until the opening quote of
+	// the pattern.
+	autocmdRegex *regexp.Regexp
+}
+
+var msgLangs []*msgLang
+
+func init() {
+	for _, f := range msgFormats {
+		l := &msgLang{msgFormat: f}
+		if f.detected != "" {
+			l.detectedRegex = compileFormat(f.detected, `(?P<throwpoint>.+)`)
+		}
+		if f.compiling != "" {
+			l.compilingRegex = compileFormat(f.compiling, `(?P<throwpoint>.+)`)
+		}
+		if f.line != "" {
+			l.lineRegex = compileFormat(f.line)
+		}
+		if f.throwpointLine != "" {
+			l.throwpointLineRegex = compileFormat(f.throwpointLine, `(?P<throwpoint>.+)`)
+		}
+		if f.lastSet != "" {
+			lastSetLine := f.lastSetLine
+			if lastSetLine == "" {
+				lastSetLine = msgFormats[0].lastSetLine
+			}
+			l.lastSetRegex = regexp.MustCompile(`^` +
+				regexp.QuoteMeta(strings.TrimPrefix(f.lastSet, "\n")) + `(?P<file>.+?)` +
+				`(?:` + regexp.QuoteMeta(lastSetLine) + `(?P<lnum>\d+))?$`)
+		}
+		if f.autocmd != "" {
+			// the pattern is the last %s and followed by `"`.
+			head := f.autocmd[:strings.LastIndex(f.autocmd, "%s")]
+			l.autocmdRegex = regexp.MustCompile(`^` + formatRegexp(head, `(?P<event>\w+)`))
+		}
+		msgLangs = append(msgLangs, l)
+	}
+}
+
+// formatRegexp converts printf-style format of Vim's message to regexp. %s
+// is replaced with args in order and %ld with "lnum" group.
+func formatRegexp(format string, args ...string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(format, '%')
+		if i == -1 {
+			b.WriteString(regexp.QuoteMeta(format))
+			return b.String()
+		}
+		b.WriteString(regexp.QuoteMeta(format[:i]))
+		format = format[i:]
+		switch {
+		case strings.HasPrefix(format, "%s") && len(args) > 0:
+			b.WriteString(args[0])
+			args, format = args[1:], format[len("%s"):]
+		case strings.HasPrefix(format, "%4ld"):
+			b.WriteString(` *(?P<lnum>\d+)`)
+			format = format[len("%4ld"):]
+		case strings.HasPrefix(format, "%ld"):
+			b.WriteString(`(?P<lnum>\d+)`)
+			format = format[len("%ld"):]
+		default:
+			b.WriteString("%")
+			format = format[1:]
+		}
+	}
+}
+
+func compileFormat(format string, args ...string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + formatRegexp(format, args...) + `$`)
+}
+
+// submatch returns the named submatch of re in s.
+func submatch(re *regexp.Regexp, s string, name string) (string, bool) {
+	if re == nil {
+		return "", false
+	}
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	return m[re.SubexpIndex(name)], true
+}
+
+// parseDetected parses the first line of error message and returns the
+// throwpoint and the language of the message. The compile error of Vim9 def
+// function is also parsed.
+// e.g. "Error detected while processing function F:" -> "function F"
+func parseDetected(line string) (string, *msgLang, bool) {
+	for _, l := range msgLangs {
+		if tp, ok := submatch(l.detectedRegex, line, "throwpoint"); ok {
+			return tp, l, true
+		}
+		if tp, ok := submatch(l.compilingRegex, line, "throwpoint"); ok {
+			return tp, l, true
+		}
+	}
+	return "", nil, false
+}
+
+// parseDetectedLine parses "line N:" in error message of the language.
+func (l *msgLang) parseDetectedLine(line string) (string, bool) {
+	return submatch(l.lineRegex, line, "lnum")
+}
@@ -0,0 +1,55 @@
+package stacktrace
+
+import "testing"
+
+func TestFormatRegexp(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []string
+		want   string
+	}{
+		{format: "line %4ld:", want: `line  *(?P<lnum>\d+):`},
+		{format: "%s, line %ld", args: []string{"(.+)"}, want: `(.+), line (?P<lnum>\d+)`},
+		{format: "%s Autocommands for \"", args: []string{`(\w+)`}, want: `(\w+) Autocommands for "`},
+		{format: "100% (%s)", want: `100% \(%s\)`},
+	}
+	for _, tt := range tests {
+		if got := formatRegexp(tt.format, tt.args...); got != tt.want {
+			t.Errorf("formatRegexp(%q, %q) = %q, want %q", tt.format, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestMsgLangs(t *testing.T) {
+	for _, l := range msgLangs {
+		if l.detectedRegex == nil || l.lineRegex == nil || l.throwpointLineRegex == nil {
+			t.Errorf("%v: error message formats are required", l.lang)
+		}
+	}
+}
+
+func TestParseDetected(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		wantLang string
+	}{
+		{in: "Error detected while processing function F:", want: "function F", wantLang: "en"},
+		{in: "function F の処理中にエラーが検出されました:", want: "function F", wantLang: "ja"},
+		{in: `Fehler beim Ausführen von "function F":`, want: "function F", wantLang: "de"},
+		{in: "Erreur détectée en traitant function F :", want: "function F", wantLang: "fr"},
+		{in: "处理 function F 时发生错误:", want: "function F", wantLang: "zh_CN"},
+		{in: "Error detected while compiling function <SNR>1_F:", want: "function <SNR>1_F", wantLang: "en"},
+		{in: "function <SNR>1_F のコンパイル中にエラーが検出されました:", want: "function <SNR>1_F", wantLang: "ja"},
+		{in: "Erreur détectée lors de la compilation function <SNR>1_F", want: "function <SNR>1_F", wantLang: "fr"},
+	}
+	for _, tt := range tests {
+		got, l, ok := parseDetected(tt.in)
+		if !ok || got != tt.want || l.lang != tt.wantLang {
+			t.Errorf("parseDetected(%q) = (%q, %v, %v), want (%q, %v)", tt.in, got, l, ok, tt.want, tt.wantLang)
+		}
+	}
+	if got, _, ok := parseDetected("E121: Undefined variable: err1"); ok {
+		t.Errorf("parseDetected(E121) = %q, want not ok", got)
+	}
+}
@@ -0,0 +1,63 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// luaTracebackHeader is the first line of Lua stack traceback.
+const luaTracebackHeader = "stack traceback:"
+
+var (
+	// Lua error messages of Neovim.
+	// e.g.
+	//   E5108: Error executing lua /path/to/foo.lua:3: attempt to index a nil value
+	//   Error executing vim.schedule lua callback: /path/to/foo.lua:3: ...
+	luaErrRegex = regexp.MustCompile(`^(?:E\d+: )?Error (?:executing|while calling) (?:.* )?lua`)
+
+	// e.g. /path/to/foo.lua:12: in function 'bar'
+	luaTracebackLineRegex = regexp.MustCompile(`^(.+?):(\d+): in (.+)$`)
+
+	// e.g. function 'bar', local 'f', method 'm', function <foo.lua:6>
+	luaFuncnameRegex = regexp.MustCompile(`^(?:function|local|upvalue|method|field|global) '(.+)'$|^function (<.+>)$`)
+)
+
+// isLuaErr reports whether the line is Lua error message of Neovim.
+func isLuaErr(line string) bool {
+	return luaErrRegex.MatchString(line)
+}
+
+// ParseLuaTraceback parses Lua stack traceback lines after "stack
+// traceback:" and returns stacks in the order of Stacktrace, the outermost
+// first. Frames without location like [C] are skipped.
+// e.g.
+//
+//	stack traceback:
+//		[C]: in function 'error'
+//		/path/to/foo.lua:3: in function 'bar'
+//		/path/to/foo.lua:7: in function </path/to/foo.lua:6>
+//		[string ":lua"]:1: in main chunk
+func ParseLuaTraceback(lines []string) []*Stack {
+	var stacks []*Stack
+	for _, line := range lines {
+		m := luaTracebackLineRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		e := &Stack{Kind: FrameLua, Text: m[3]}
+		if fm := luaFuncnameRegex.FindStringSubmatch(m[3]); fm != nil {
+			e.Funcname = fm[1] + fm[2]
+		}
+		e.Lnum, _ = strconv.Atoi(m[2])
+		// chunk name of string is not a file. e.g. [string ":lua"]
+		if isPseudoFile(m[1]) {
+			e.Text = m[1] + ":" + m[2] + ": " + e.Text
+			e.Lnum = 0
+		} else {
+			e.Filename = expandpath(m[1])
+		}
+		stacks = append([]*Stack{e}, stacks...)
+	}
+	return stacks
+}
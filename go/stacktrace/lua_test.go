@@ -0,0 +1,82 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIsLuaErr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "E5108: Error executing lua /path/to/foo.lua:3: attempt to index a nil value", want: true},
+		{in: "E5113: Error while calling lua chunk: /path/to/init.lua:1: err", want: true},
+		{in: "Error executing vim.schedule lua callback: /path/to/foo.lua:3: err", want: true},
+		{in: "Error executing lua callback: /path/to/foo.lua:3: err", want: true},
+		{in: "E121: Undefined variable: lua"},
+		{in: "Error detected while processing function F:"},
+	}
+	for _, tt := range tests {
+		if got := isLuaErr(tt.in); got != tt.want {
+			t.Errorf("isLuaErr(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseLuaTraceback(t *testing.T) {
+	lines := []string{
+		"\t[C]: in function 'error'",
+		"\t/path/to/foo.lua:3: in function 'bar'",
+		"\t/path/to/foo.lua:7: in function </path/to/foo.lua:6>",
+		"\t/path/to/foo.lua:10: in local 'f'",
+		"\t(...tail calls...)",
+		"\t[string \":lua\"]:1: in main chunk",
+	}
+	want := []*Stack{
+		{Kind: FrameLua, Text: "[string \":lua\"]:1: main chunk"},
+		{Kind: FrameLua, Funcname: "f", Filename: "/path/to/foo.lua", Lnum: 10, Text: "local 'f'"},
+		{Kind: FrameLua, Funcname: "</path/to/foo.lua:6>", Filename: "/path/to/foo.lua", Lnum: 7, Text: "function </path/to/foo.lua:6>"},
+		{Kind: FrameLua, Funcname: "bar", Filename: "/path/to/foo.lua", Lnum: 3, Text: "function 'bar'"},
+	}
+	got := ParseLuaTraceback(lines)
+	if !reflect.DeepEqual(got, want) {
+		for _, e := range got {
+			t.Errorf("got : %#v", e)
+		}
+		for _, e := range want {
+			t.Errorf("want: %#v", e)
+		}
+	}
+}
+
+func TestVim_buildTraceback_lua(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	defer os.Remove(tmp.Name())
+	tmp.WriteString("local M = {}\nfunction M.bar()\n  return nil + 1\nend\n")
+	filename := tmp.Name()
+
+	v := &Vim{c: cli}
+	in := []*Stack{
+		{Kind: FrameLua, Text: "[string \":lua\"]:1: main chunk"},
+		{Kind: FrameLua, Funcname: "bar", Filename: filename, Lnum: 3, Text: "function 'bar'"},
+	}
+	want := []*Stack{
+		{Kind: FrameLua, Text: "[string \":lua\"]:1: main chunk"},
+		{Kind: FrameLua, Funcname: "bar", Filename: filename, Lnum: 3, Line: "  return nil + 1", Text: "function 'bar': return nil + 1"},
+	}
+	if got := v.buildTraceback(in); !reflect.DeepEqual(got, want) {
+		for _, e := range got {
+			t.Errorf("got : %#v", e)
+		}
+	}
+	if in[1].Line != "" {
+		t.Errorf("buildTraceback() modified the given stack: %#v", in[1])
+	}
+}
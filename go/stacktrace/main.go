@@ -1,6 +1,7 @@
 package stacktrace
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -16,11 +17,14 @@ func init() {
 	homedir = usr.HomeDir
 }
 
-type myHandler struct{}
+type myHandler struct {
+	// cache of source files shared by requests
+	cache *sourceCache
+}
 
 func (h *myHandler) Serve(cli *vim.Client, msg *vim.Message) {
 	if msg.MsgID > 0 {
-		ret, err := (&Vim{c: cli}).handle(msg.Body)
+		ret, err := (&Vim{c: cli, cache: h.cache}).handle(msg.Body)
 		if err != nil {
 			ret = &Err{Error: err.Error()}
 		}
@@ -62,17 +66,46 @@ func (cli *Vim) handle(msgBody vim.Body) (interface{}, error) {
 		} else if _, ok := t.(string); !ok {
 			return nil, fmt.Errorf("msghist is not string: %+v", t)
 		}
-		return Histerrs(t.(string)), nil
+		return histerrsAnalyzed(t.(string)), nil
+	case "stacktrace#histgroups":
+		t, ok := body["msghist"]
+		if !ok {
+			return nil, fmt.Errorf("msghist is required in message body: %v", body)
+		} else if _, ok := t.(string); !ok {
+			return nil, fmt.Errorf("msghist is not string: %+v", t)
+		}
+		return Histgroups(t.(string)), nil
 	case "stacktrace#fromhist":
 		return cli.Fromhist()
+	case "stacktrace#snapshot":
+		t, ok := body["file"]
+		if !ok {
+			return nil, fmt.Errorf("file is required in message body: %v", body)
+		} else if _, ok := t.(string); !ok {
+			return nil, fmt.Errorf("file is not string: %+v", t)
+		}
+		return nil, cli.Snapshot(t.(string))
 	default:
 		return nil, fmt.Errorf("got an unexpected id: %v", s)
 	}
 }
 
-// Main func.
+// Main func. It serves Neovim over msgpack-RPC with -nvim flag, or runs the
+// subcommand without Vim. e.g. vim-stacktrace histerrs < messages.txt
 func Main() {
-	handler := &myHandler{}
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd.run(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+	nvimMode := flag.Bool("nvim", false, "serve Neovim over msgpack-RPC")
+	flag.Usage = func() { printUsage(os.Stderr) }
+	flag.Parse()
+	if *nvimMode {
+		NvimMain()
+		return
+	}
+	handler := &myHandler{cache: newSourceCache()}
 	cli := vim.NewClient(vim.NewReadWriter(os.Stdin, os.Stdout), handler)
 	log.Fatal(cli.Start())
 }
@@ -34,6 +34,7 @@ func TestVimHandle(t *testing.T) {
 	}{
 		{map[string]interface{}{"id": "stacktrace#build", "throwpoint": "function F[1]"}},
 		{map[string]interface{}{"id": "stacktrace#histerrs", "msghist": ""}},
+		{map[string]interface{}{"id": "stacktrace#histgroups", "msghist": ""}},
 		{map[string]interface{}{"id": "stacktrace#fromhist"}},
 	}
 	for _, tt := range tests {
@@ -57,6 +58,11 @@ func TestVimHandle_error(t *testing.T) {
 		{map[string]interface{}{"id": "stacktrace#build", "throwpoint": 1}},
 		{map[string]interface{}{"id": "stacktrace#histerrs"}},
 		{map[string]interface{}{"id": "stacktrace#histerrs", "msghist": 1}},
+		{map[string]interface{}{"id": "stacktrace#histgroups"}},
+		{map[string]interface{}{"id": "stacktrace#histgroups", "msghist": 1}},
+		{map[string]interface{}{"id": "stacktrace#snapshot"}},
+		{map[string]interface{}{"id": "stacktrace#snapshot", "file": 1}},
+		{map[string]interface{}{"id": "stacktrace#snapshot", "file": "/path/to/notfound.vim"}},
 	}
 	for _, tt := range tests {
 		got, err := v.handle(tt.in)
@@ -0,0 +1,141 @@
+package stacktrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+
+	vim "github.com/haya14busa/vim-go-client"
+	"github.com/neovim/go-client/nvim"
+)
+
+// nvimClient calls Neovim functions over msgpack-RPC.
+type nvimClient struct {
+	v *nvim.Nvim
+}
+
+func (c *nvimClient) Call(funcname string, args ...interface{}) (vim.Body, error) {
+	var ret interface{}
+	if err := c.v.Call(funcname, &ret, args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NvimMain serves stacktrace functions to Neovim over msgpack-RPC. Neovim
+// starts it by jobstart() with rpc option and calls the methods, which have
+// the same names as the ids of Vim's channel messages, by rpcrequest().
+func NvimMain() {
+	v, err := nvim.New(os.Stdin, os.Stdout, os.Stdout, log.Printf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cli := &Vim{c: &nvimClient{v: v}, cache: newSourceCache()}
+	for method, fn := range cli.nvimHandlers() {
+		if err := v.RegisterHandler(method, fn); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Fatal(v.Serve())
+}
+
+// nvimHandlers returns msgpack-RPC handlers by method name.
+func (cli *Vim) nvimHandlers() map[string]interface{} {
+	return map[string]interface{}{
+		"stacktrace#callstack": func() (interface{}, error) {
+			return jsonValue(cli.Callstack())
+		},
+		"stacktrace#build": func(throwpoint string) (interface{}, error) {
+			return jsonValue(cli.Build(throwpoint))
+		},
+		"stacktrace#histerrs": func(msghist string) (interface{}, error) {
+			return jsonValue(histerrsAnalyzed(msghist), nil)
+		},
+		"stacktrace#histgroups": func(msghist string) (interface{}, error) {
+			return jsonValue(Histgroups(msghist), nil)
+		},
+		"stacktrace#fromhist": func() (interface{}, error) {
+			return jsonValue(cli.Fromhist())
+		},
+		"stacktrace#snapshot": func(file string) error {
+			return cli.Snapshot(file)
+		},
+	}
+}
+
+// jsonValue converts v to the value which has the same fields as Vim's JSON
+// channel. Integers are kept as int64 to be Number in Neovim, not Float.
+func jsonValue(v interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var ret interface{}
+	if err := d.Decode(&ret); err != nil {
+		return nil, err
+	}
+	return fromJSONNumber(ret), nil
+}
+
+func fromJSONNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, e := range v {
+			v[i] = fromJSONNumber(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fromJSONNumber(e)
+		}
+	}
+	return v
+}
+
+var (
+	// Script name of the Ex commands executed by nvim_exec2() from Lua.
+	// e.g. nvim_exec2() called at /path/to/init.lua:12
+	nvimExecRegex = regexp.MustCompile(`^nvim_exec2?\(\) called at (.+):(\d+)$`)
+
+	// Script names of Neovim which are not files. :h :verbose
+	// e.g. Lua (run Nvim with -V1 for more details), API client (channel id 3)
+	nvimNoFileRegex = regexp.MustCompile(`^(?:Lua\b|API client \(channel id \d+\)|anonymous :source\b)`)
+
+	// Lua callback in :autocmd listing.
+	// e.g. <Lua 42: /path/to/init.lua:12>
+	nvimLuaCallbackRegex = regexp.MustCompile(`^<Lua \d+: (.+):(\d+)>$`)
+)
+
+// parseNvimExec parses the script name of nvim_exec2() and returns the Lua
+// file and the line number which calls it.
+func parseNvimExec(name string) (string, int, bool) {
+	return parseFileLnum(nvimExecRegex, name)
+}
+
+// parseNvimLuaCallback parses Lua callback of autocmd and returns the Lua
+// file and the line number where it's defined.
+func parseNvimLuaCallback(cmd string) (string, int, bool) {
+	return parseFileLnum(nvimLuaCallbackRegex, cmd)
+}
+
+func parseFileLnum(re *regexp.Regexp, s string) (string, int, bool) {
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return "", 0, false
+	}
+	lnum, _ := strconv.Atoi(m[2])
+	return expandpath(m[1]), lnum, true
+}
@@ -0,0 +1,81 @@
+package stacktrace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONValue(t *testing.T) {
+	in := &Stacktrace{
+		Stacks: []*Stack{
+			{Kind: FrameFunction, Funcname: "F", Flnum: 2, Filename: "/path/to/file.vim", Lnum: 4, Text: "F:2:"},
+		},
+	}
+	want := map[string]interface{}{
+		"stacks": []interface{}{
+			map[string]interface{}{
+				"kind":     "function",
+				"funcname": "F",
+				"flnum":    int64(2),
+				"filename": "/path/to/file.vim",
+				"lnum":     int64(4),
+				"text":     "F:2:",
+			},
+		},
+	}
+	got, err := jsonValue(in, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonValue() = %#v, want %#v", got, want)
+	}
+}
+
+func TestVim_nvimHandlers(t *testing.T) {
+	handlers := (&Vim{c: cli}).nvimHandlers()
+	for _, method := range []string{"stacktrace#callstack", "stacktrace#build", "stacktrace#histerrs", "stacktrace#histgroups", "stacktrace#fromhist", "stacktrace#snapshot"} {
+		if _, ok := handlers[method]; !ok {
+			t.Errorf("handler for %v not found", method)
+		}
+	}
+	got, err := handlers["stacktrace#histerrs"].(func(string) (interface{}, error))("Error detected while processing function F:\nline    3:\nE121: err")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		map[string]interface{}{"throwpoint": "function F[3]", "messages": []interface{}{"E121: err"}, "severity": "error",
+			"lnum": int64(1), "end_lnum": int64(3),
+			"cause": map[string]interface{}{"message": "E121: err", "location": "function F[3]"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stacktrace#histerrs = %#v, want %#v", got, want)
+	}
+	got, err = handlers["stacktrace#histgroups"].(func(string) (interface{}, error))(strings.Repeat("Error detected while processing function F:\nline    3:\nE121: err\n", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups, ok := got.([]interface{}); !ok || len(groups) != 1 || groups[0].(map[string]interface{})["count"] != int64(2) {
+		t.Errorf("stacktrace#histgroups = %#v, want a group of 2 errors", got)
+	}
+}
+
+func TestParseNvimLuaCallback(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantFile string
+		wantLnum int
+		wantOK   bool
+	}{
+		{in: "<Lua 42: /path/to/init.lua:12>", wantFile: "/path/to/init.lua", wantLnum: 12, wantOK: true},
+		{in: "<Lua 42: /path/to/a:b.lua:3>", wantFile: "/path/to/a:b.lua", wantLnum: 3, wantOK: true},
+		{in: "call F()"},
+	}
+	for _, tt := range tests {
+		file, lnum, ok := parseNvimLuaCallback(tt.in)
+		if file != tt.wantFile || lnum != tt.wantLnum || ok != tt.wantOK {
+			t.Errorf("parseNvimLuaCallback(%q) = (%v, %v, %v), want (%v, %v, %v)", tt.in, file, lnum, ok, tt.wantFile, tt.wantLnum, tt.wantOK)
+		}
+	}
+}
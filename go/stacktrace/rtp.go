@@ -0,0 +1,152 @@
+package stacktrace
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rtpIndex is an index of the functions defined in the .vim files under the
+// runtimepath directories. It resolves function stacks by name without Vim.
+type rtpIndex struct {
+	// definitions by the normalized function name. e.g. F, s:f, foo#bar
+	defs map[string][]*rtpDef
+
+	// function index by filename
+	files map[string]*funcIndex
+}
+
+// rtpDef represents a function definition in the runtimepath.
+type rtpDef struct {
+	file string
+	lnum int
+}
+
+func (d *rtpDef) String() string {
+	return fmt.Sprintf("%s:%d", d.file, d.lnum)
+}
+
+// Offline returns Vim which builds stacktrace without Vim. Functions are
+// resolved by name in the .vim files under the runtimepath directories, so
+// the throwpoint from other environment (e.g. issue report) can be built.
+func Offline(runtimepath []string) (*Vim, error) {
+	idx, err := newRtpIndex(runtimepath)
+	if err != nil {
+		return nil, err
+	}
+	return &Vim{c: offlineClient{}, rtp: idx}, nil
+}
+
+// newRtpIndex indexes the .vim files under the directories. The files which
+// cannot be parsed are ignored.
+func newRtpIndex(dirs []string) (*rtpIndex, error) {
+	idx := &rtpIndex{
+		defs:  make(map[string][]*rtpDef),
+		files: make(map[string]*funcIndex),
+	}
+	for _, dir := range dirs {
+		dir = expandpath(dir)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != dir && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(path) == ".vim" {
+				idx.add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, defs := range idx.defs {
+		sort.Slice(defs, func(i, j int) bool { return defs[i].file < defs[j].file })
+	}
+	return idx, nil
+}
+
+// add indexes the functions in file.
+func (idx *rtpIndex) add(file string) {
+	if _, ok := idx.files[file]; ok {
+		return
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	fidx := newFuncIndex(file, src, strings.Split(string(src), "\n"))
+	if fidx == nil {
+		return
+	}
+	idx.files[file] = fidx
+	for name, lnum := range fidx.names {
+		idx.defs[name] = append(idx.defs[name], &rtpDef{file: file, lnum: lnum})
+	}
+}
+
+// lookup returns the definitions of funcname. The definitions in the files
+// of the same <SNR> number in snrs and the autoload files of the name are
+// preferred.
+func (idx *rtpIndex) lookup(funcname string, snrs map[string]string) []*rtpDef {
+	name, snr := funcname, ""
+	if strings.HasPrefix(funcname, "<SNR>") {
+		i := strings.Index(funcname, "_")
+		if i < 0 {
+			return nil
+		}
+		snr = funcname[len("<SNR>"):i]
+		name = "s:" + funcname[i+1:]
+	}
+	defs := idx.defs[name]
+	if file, ok := snrs[snr]; ok && snr != "" {
+		if ds := filterDefs(defs, func(d *rtpDef) bool { return d.file == file }); len(ds) > 0 {
+			return ds
+		}
+	}
+	if i := strings.LastIndex(name, "#"); i > 0 {
+		// foo#bar#baz is defined in autoload/foo/bar.vim
+		p := string(filepath.Separator) + filepath.Join("autoload", filepath.FromSlash(strings.Replace(name[:i], "#", "/", -1))) + ".vim"
+		if ds := filterDefs(defs, func(d *rtpDef) bool { return strings.HasSuffix(d.file, p) }); len(ds) > 0 {
+			return ds
+		}
+	}
+	return defs
+}
+
+func filterDefs(defs []*rtpDef, f func(*rtpDef) bool) []*rtpDef {
+	var ds []*rtpDef
+	for _, d := range defs {
+		if f(d) {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// resolve resolves the definition of function stack e by name. snrs maps
+// <SNR> number to filename, which is resolved by the previous stacks. If
+// the name is ambiguous, it uses the first definition and stores the others
+// to e.Candidates.
+func (idx *rtpIndex) resolve(e *Stack, snrs map[string]string) {
+	defs := idx.lookup(e.Funcname, snrs)
+	if len(defs) == 0 {
+		return
+	}
+	d := defs[0]
+	for _, c := range defs[1:] {
+		e.Candidates = append(e.Candidates, c.String())
+	}
+	e.setLocation(d.file, d.lnum+e.Flnum, idx.files[d.file].lines)
+	if len(defs) == 1 && strings.HasPrefix(e.Funcname, "<SNR>") {
+		snrs[e.Funcname[len("<SNR>"):strings.Index(e.Funcname, "_")]] = d.file
+	}
+}
@@ -0,0 +1,116 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"plugin/a.vim": `
+function! s:only() abort
+  return s:dup()
+endfunction
+
+function! s:dup() abort
+  throw 'a'
+endfunction
+`,
+		"plugin/b.vim": `
+function! s:dup() abort
+  throw 'b'
+endfunction
+
+function! Global() abort
+  call foo#bar#baz()
+endfunction
+`,
+		"autoload/foo/bar.vim": `
+function! foo#bar#baz() abort
+  let x = 1
+  return s:dup()
+endfunction
+`,
+		// defined in the wrong file
+		"autoload/foo.vim": `
+function! foo#bar#baz() abort
+endfunction
+`,
+		".git/x.vim": `
+function! Global() abort
+endfunction
+`,
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := filepath.Join(dir, "plugin", "a.vim")
+	b := filepath.Join(dir, "plugin", "b.vim")
+	bar := filepath.Join(dir, "autoload", "foo", "bar.vim")
+
+	v, err := Offline([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in   string
+		want []*Stack
+	}{
+		{
+			in: "function Global[1]..foo#bar#baz[2]",
+			want: []*Stack{
+				{Kind: FrameFunction, Funcname: "Global", Flnum: 1, Line: "  call foo#bar#baz()", Filename: b, Lnum: 7, Text: "Global:1:  call foo#bar#baz()"},
+				{Kind: FrameFunction, Funcname: "foo#bar#baz", Flnum: 2, Line: "  return s:dup()", Filename: bar, Lnum: 4, Text: "foo#bar#baz:2:  return s:dup()"},
+			},
+		},
+		{
+			in: "function <SNR>3_dup[1]",
+			want: []*Stack{
+				{Kind: FrameFunction, Funcname: "<SNR>3_dup", Flnum: 1, Line: "  throw 'a'", Filename: a, Lnum: 7, Text: "<SNR>3_dup:1:  throw 'a'", Candidates: []string{b + ":2"}},
+			},
+		},
+		{
+			in: "function <SNR>3_only[1]..<SNR>3_dup[1]",
+			want: []*Stack{
+				{Kind: FrameFunction, Funcname: "<SNR>3_only", Flnum: 1, Line: "  return s:dup()", Filename: a, Lnum: 3, Text: "<SNR>3_only:1:  return s:dup()"},
+				{Kind: FrameFunction, Funcname: "<SNR>3_dup", Flnum: 1, Line: "  throw 'a'", Filename: a, Lnum: 7, Text: "<SNR>3_dup:1:  throw 'a'"},
+			},
+		},
+		{
+			in: "function Unknown[1]",
+			want: []*Stack{
+				{Kind: FrameFunction, Funcname: "Unknown", Flnum: 1, Text: "Unknown:1:", Status: StatusNotFound, Error: "function Unknown is not found: Vim is not running"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := v.Build(tt.in)
+		if err != nil {
+			t.Errorf("Build(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Stacks, tt.want) {
+			t.Errorf("Build(%q)", tt.in)
+			for _, s := range got.Stacks {
+				t.Logf("got:  %#v", s)
+			}
+			for _, s := range tt.want {
+				t.Logf("want: %#v", s)
+			}
+		}
+	}
+}
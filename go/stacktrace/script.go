@@ -0,0 +1,96 @@
+package stacktrace
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// scriptTable maps script ID to script path. :h :scriptnames
+type scriptTable map[int]string
+
+// e.g. "  3: ~/.vim/plugin/foo.vim", " 12 A: /path/to/autoload/foo.vim"
+var scriptnamesRegex = regexp.MustCompile(`^\s*(\d+)(?:\s+A)?:\s+(.+)$`)
+
+// parseScriptnames parses :scriptnames output.
+func parseScriptnames(out string) scriptTable {
+	t := make(scriptTable)
+	for _, l := range strings.Split(out, "\n") {
+		m := scriptnamesRegex.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		t[id] = expandpath(m[2])
+	}
+	return t
+}
+
+// scriptTable returns the script table of Vim. It's nil if Vim isn't
+// available.
+func (cli *Vim) scriptTable() scriptTable {
+	out, err := cli.scriptnames()
+	if err != nil {
+		return nil
+	}
+	return parseScriptnames(out)
+}
+
+// lookup returns the script ID and path of script local function funcname.
+// e.g. <SNR>96_test, <SNR>96_Cls.Method
+func (t scriptTable) lookup(funcname string) (int, string, bool) {
+	if !strings.HasPrefix(funcname, "<SNR>") {
+		return 0, "", false
+	}
+	i := strings.Index(funcname, "_")
+	if i < 0 {
+		return 0, "", false
+	}
+	id, err := strconv.Atoi(funcname[len("<SNR>"):i])
+	if err != nil {
+		return 0, "", false
+	}
+	path, ok := t[id]
+	return id, path, ok
+}
+
+// runtimeDirs are the directories searched in runtimepath which contain
+// Vim script. :h 'runtimepath'
+var runtimeDirs = map[string]bool{
+	"autoload": true,
+	"colors":   true,
+	"compiler": true,
+	"ftdetect": true,
+	"ftplugin": true,
+	"import":   true,
+	"indent":   true,
+	"keymap":   true,
+	"plugin":   true,
+	"syntax":   true,
+}
+
+// displayScript returns short script path relative to the runtimepath
+// directory. e.g. /path/to/vim-foo/autoload/foo.vim -> autoload/foo.vim
+func displayScript(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i := len(parts) - 2; i >= 0; i-- {
+		if runtimeDirs[parts[i]] {
+			return strings.Join(parts[i:], "/")
+		}
+	}
+	if homedir != "" && strings.HasPrefix(path, homedir+string(filepath.Separator)) {
+		return "~" + path[len(homedir):]
+	}
+	return path
+}
+
+// displayFuncname returns function name for display. Script local function
+// is shown as s:name with the script. e.g. s:test (autoload/foo.vim)
+func displayFuncname(funcname, script string) string {
+	if script == "" {
+		return funcname
+	}
+	return fmt.Sprintf("s:%s (%s)", funcname[strings.Index(funcname, "_")+1:], displayScript(script))
+}
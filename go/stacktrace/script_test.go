@@ -0,0 +1,63 @@
+package stacktrace
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseScriptnames(t *testing.T) {
+	out := `
+  1: /usr/share/vim/vimrc
+  2: ~/.vim/autoload/foo.vim
+ 12 A: /path/to/autoload/bar.vim
+`
+	want := scriptTable{
+		1:  "/usr/share/vim/vimrc",
+		2:  filepath.Join(homedir, ".vim/autoload/foo.vim"),
+		12: "/path/to/autoload/bar.vim",
+	}
+	if got := parseScriptnames(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseScriptnames() = %v, want %v", got, want)
+	}
+}
+
+func TestScriptTable_lookup(t *testing.T) {
+	table := scriptTable{96: "/path/to/autoload/foo.vim"}
+	tests := []struct {
+		in   string
+		id   int
+		path string
+		ok   bool
+	}{
+		{in: "<SNR>96_test", id: 96, path: "/path/to/autoload/foo.vim", ok: true},
+		{in: "<SNR>96_Cls.Method", id: 96, path: "/path/to/autoload/foo.vim", ok: true},
+		{in: "<SNR>97_test", id: 97},
+		{in: "F"},
+		{in: "foo#bar"},
+	}
+	for _, tt := range tests {
+		id, path, ok := table.lookup(tt.in)
+		if id != tt.id || path != tt.path || ok != tt.ok {
+			t.Errorf("lookup(%q) = (%v, %q, %v), want (%v, %q, %v)", tt.in, id, path, ok, tt.id, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestDisplayFuncname(t *testing.T) {
+	tests := []struct {
+		funcname, script, want string
+	}{
+		{"<SNR>96_test", "/path/to/vim-foo/autoload/foo.vim", "s:test (autoload/foo.vim)"},
+		{"<SNR>96_test", "/path/to/vim-foo/after/plugin/foo/bar.vim", "s:test (plugin/foo/bar.vim)"},
+		{"<SNR>3_Cls.Method", "/tmp/test.vim", "s:Cls.Method (/tmp/test.vim)"},
+		{"<SNR>3_test", filepath.Join(homedir, "test.vim"), "s:test (~/test.vim)"},
+		{"<SNR>3_test", "", "<SNR>3_test"},
+		{"F", "", "F"},
+	}
+	for _, tt := range tests {
+		if got := displayFuncname(tt.funcname, tt.script); got != tt.want {
+			t.Errorf("displayFuncname(%q, %q) = %q, want %q", tt.funcname, tt.script, got, tt.want)
+		}
+	}
+}
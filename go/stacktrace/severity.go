@@ -0,0 +1,104 @@
+package stacktrace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Severity represents the severity of the error in message history.
+type Severity int
+
+const (
+	// SeverityError is the error. e.g. "E121: Undefined variable: x", the
+	// message of :echoerr
+	SeverityError Severity = iota
+	// SeverityWarning is the warning. e.g. "W10: Warning: Changing a readonly
+	// file"
+	SeverityWarning
+	// SeverityInfo is the message of plugin outside the error. e.g. "[ALE]
+	// No linter is enabled"
+	SeverityInfo
+)
+
+var severityNames = [...]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityInfo:    "info",
+}
+
+// Type of quickfix by severity. :h setqflist()
+var severityTypes = [...]string{
+	SeverityError:   "E",
+	SeverityWarning: "W",
+	SeverityInfo:    "I",
+}
+
+func (s Severity) String() string {
+	if 0 <= int(s) && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return "Severity(" + strconv.Itoa(int(s)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	if 0 <= int(s) && int(s) < len(severityNames) {
+		return []byte(severityNames[s]), nil
+	}
+	return nil, fmt.Errorf("invalid severity: %d", int(s))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if name == string(text) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity: %q", text)
+}
+
+// qfType returns the type of quickfix. It's empty for unknown severity.
+func (s Severity) qfType() string {
+	if 0 <= int(s) && int(s) < len(severityTypes) {
+		return severityTypes[s]
+	}
+	return ""
+}
+
+var (
+	// e.g. "W10: Warning: Changing a readonly file"
+	histerrsWarnRegex = regexp.MustCompile(`^W\d+:`)
+	// The message of plugin which has the name in brackets.
+	// e.g. "[ALE] No linter is enabled", "[coc.nvim] service not started"
+	pluginMsgRegex = regexp.MustCompile(`^\[[\w.#-]+\] *\S`)
+)
+
+// isCodedMsg reports whether the line is the error or warning message with the
+// number. e.g. E121, W10
+func isCodedMsg(line string) bool {
+	return histerrsErrRegex.MatchString(line) || histerrsWarnRegex.MatchString(line)
+}
+
+// isPluginMsg reports whether the line is the message of plugin without the
+// number.
+func isPluginMsg(line string) bool {
+	return pluginMsgRegex.MatchString(line)
+}
+
+// msgsSeverity returns the severity of the error messages. It's a warning only
+// if all messages are warnings. The messages without number are from :echoerr
+// or the errors of Lua and interfaces.
+func msgsSeverity(msgs []string) Severity {
+	if len(msgs) == 0 {
+		return SeverityError
+	}
+	for _, msg := range msgs {
+		if !histerrsWarnRegex.MatchString(msg) {
+			return SeverityError
+		}
+	}
+	return SeverityWarning
+}
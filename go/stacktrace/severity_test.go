@@ -0,0 +1,46 @@
+package stacktrace
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSeverity_MarshalText(t *testing.T) {
+	for s := SeverityError; s <= SeverityInfo; s++ {
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Severity
+		if err := json.Unmarshal(b, &got); err != nil || got != s {
+			t.Errorf("json round trip of %v = %v, %v", s, got, err)
+		}
+	}
+	if _, err := json.Marshal(Severity(100)); err == nil {
+		t.Error("Severity(100) should not be marshaled")
+	}
+}
+
+func TestVim_buildError_type(t *testing.T) {
+	v := &Vim{c: offlineClient{}}
+	tests := []struct {
+		in   *Error
+		want string
+	}{
+		{&Error{Throwpoint: "function F[1]..G[2]", Messages: []string{"failed"}}, "E"},
+		{&Error{Throwpoint: "function F[1]..G[2]", Messages: []string{"W10: w"}, Severity: SeverityWarning}, "W"},
+		{&Error{Throwpoint: "function F[1]..G[2]", Messages: []string{"[plugin] done"}, Severity: SeverityInfo}, "I"},
+	}
+	for _, tt := range tests {
+		got, err := v.buildError(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first := got.Stacks[0]; first.Type != "" {
+			t.Errorf("the type of caller = %q, want empty", first.Type)
+		}
+		if last := got.Stacks[len(got.Stacks)-1]; last.Type != tt.want {
+			t.Errorf("the type of %v = %q, want %q", tt.in.Severity, last.Type, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Snapshot keeps the content of the script file as it's sourced now. The
+// frames in the file are resolved with the snapshot instead of the file on
+// disk, which may be edited after it's sourced, until it's sourced again.
+// Each snapshot holds a copy of the file in memory, and the oldest ones are
+// dropped when they exceed 32 MiB in total.
+//
+// vimdoc:func:
+//	stacktrace#snapshot({file})	*stacktrace#snapshot()*
+//		Keeps the content of {file} as it's sourced now. It's called by
+//		|SourcePost| autocmd if |g:stacktrace#snapshot| is true.
+func (cli *Vim) Snapshot(file string) error {
+	return cli.sources().snapshot(expandpath(file))
+}
+
+// snapshot reads the file and keeps it. It replaces the previous snapshot of
+// the file and drops the oldest snapshots if they exceed maxSnapshotSize.
+func (c *sourceCache) snapshot(path string) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropSnapshot(path)
+	c.snapshots[path] = newSourceFile(src)
+	c.snapshotOrder = append(c.snapshotOrder, path)
+	c.snapshotSize += len(src)
+	for c.snapshotSize > c.maxSnapshotSize && len(c.snapshotOrder) > 0 {
+		c.dropSnapshot(c.snapshotOrder[0])
+	}
+	return nil
+}
+
+// dropSnapshot deletes the snapshot of the file if any. c.mu must be held.
+func (c *sourceCache) dropSnapshot(path string) {
+	f, ok := c.snapshots[path]
+	if !ok {
+		return
+	}
+	delete(c.snapshots, path)
+	c.snapshotSize -= len(f.src)
+	for i, p := range c.snapshotOrder {
+		if p == path {
+			c.snapshotOrder = append(c.snapshotOrder[:i], c.snapshotOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+var (
+	// e.g. "      \ 'a': 1,"
+	continuationRegex = regexp.MustCompile(`^\s*\\(.*)$`)
+	// e.g. `      "\ comment`
+	continuationCommentRegex = regexp.MustCompile(`^\s*"\\ `)
+)
+
+// logicalLine returns the line at lnum joined with the following continuation
+// lines as Vim stores it in the function. :h line-continuation
+func (f *sourceFile) logicalLine(lnum int) (string, bool) {
+	l, ok := f.line(lnum)
+	if !ok {
+		return "", false
+	}
+	for i := lnum + 1; ; i++ {
+		next, ok := f.line(i)
+		if !ok {
+			break
+		}
+		if m := continuationRegex.FindStringSubmatch(next); m != nil {
+			l += m[1]
+		} else if !continuationCommentRegex.MatchString(next) {
+			break
+		}
+	}
+	return l, true
+}
+
+// checkStale marks function stack e as stale if the line of the file at
+// e.Lnum isn't the line of the function listing, i.e. the file has been
+// edited since it was sourced. The stack is kept as is if the file cannot be
+// read.
+func (cli *Vim) checkStale(e *Stack) {
+	f, err := cli.sources().file(e.Filename)
+	if err != nil {
+		return
+	}
+	physical, ok := f.line(e.Lnum)
+	if !ok {
+		e.fail(StatusStale, "line %d is out of range of %s which has been changed since it was sourced", e.Lnum, e.Filename)
+		return
+	}
+	logical, _ := f.logicalLine(e.Lnum)
+	// The line of :def function isn't joined.
+	if !sameLine(logical, e.Line) && !sameLine(physical, e.Line) {
+		e.fail(StatusStale, "%s:%d has been changed since it was sourced: %q", e.Filename, e.Lnum, strings.TrimSpace(physical))
+	}
+}
+
+// sameLine reports whether the lines are the same ignoring the indent and the
+// amount of spaces, which are changed in the function listing.
+func sameLine(a, b string) bool {
+	return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+}
@@ -0,0 +1,115 @@
+package stacktrace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSourceFile_logicalLine(t *testing.T) {
+	f := newSourceFile([]byte(`let x = [
+      \ 1,
+      "\ comment
+      \ 2]
+let y = 1
+\ + 1`))
+	tests := []struct {
+		lnum int
+		want string
+		ok   bool
+	}{
+		{1, "let x = [ 1, 2]", true},
+		{5, "let y = 1 + 1", true},
+		{6, `\ + 1`, true},
+		{7, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := f.logicalLine(tt.lnum)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("logicalLine(%d) = (%q, %v), want (%q, %v)", tt.lnum, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVim_Build_stale(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.WriteString(`function! StaleF() abort
+  let x = [
+        \ 1,
+        \ 2]
+  return x
+endfunction
+`)
+	tmp.Close()
+	filename := tmp.Name()
+	if _, err := cli.Call("execute", ":source "+filename); err != nil {
+		t.Fatal(err)
+	}
+	fresh := &Vim{c: cli}
+	snapshot := &Vim{c: cli}
+	if err := snapshot.Snapshot(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(v *Vim, throwpoint string, lnum int, status Status) {
+		t.Helper()
+		got, err := v.Build(throwpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := got.Stacks[0]
+		if e.Lnum != lnum || e.Status != status {
+			t.Errorf("Build(%q) = %d (%v: %s), want %d (%v)", throwpoint, e.Lnum, e.Status, e.Error, lnum, status)
+		}
+	}
+	check(fresh, "function StaleF[1]", 2, StatusOK)
+	check(fresh, "function StaleF[4]", 5, StatusOK)
+
+	// edit the file after it's sourced. The modification time moves forward as
+	// an editor writes the file.
+	later := time.Now().Add(time.Second)
+	if err := ioutil.WriteFile(filename, []byte("\" header\n\nfunction! StaleF() abort\n  return 1\nendfunction\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+	check(fresh, "function StaleF[1]", 2, StatusStale)
+	check(fresh, "function StaleF[4]", 5, StatusStale)
+	check(snapshot, "function StaleF[1]", 2, StatusOK)
+	check(snapshot, "script "+filename+"[5]", 5, StatusOK)
+	if got, _ := snapshot.Build("script " + filename + "[5]"); got.Stacks[0].Line != "  return x" {
+		t.Errorf("script stack with snapshot = %q, want the sourced line", got.Stacks[0].Line)
+	}
+}
+
+func TestSourceCache_snapshot_limit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := newSourceCache()
+	c.maxSnapshotSize = 14
+	for _, name := range []string{"a.vim", "b.vim", "a.vim", "c.vim"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("\" "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.snapshot(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b.vim is the oldest since a.vim is sourced again.
+	want := []string{filepath.Join(dir, "a.vim"), filepath.Join(dir, "c.vim")}
+	if !reflect.DeepEqual(c.snapshotOrder, want) || len(c.snapshots) != 2 || c.snapshotSize != 14 {
+		t.Errorf("snapshots = %v (%d bytes), want %v (14 bytes)", c.snapshotOrder, c.snapshotSize, want)
+	}
+}
@@ -1,24 +1,14 @@
 package stacktrace
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 
-	vimlparser "github.com/haya14busa/go-vimlparser"
-	"github.com/haya14busa/go-vimlparser/ast"
 	vim "github.com/haya14busa/vim-go-client"
 )
 
-var (
-	fileFuncLines   = make(map[string]map[string]int)
-	fileFuncLinesMu sync.RWMutex
-)
-
 // Err represents error from stacktrace.go.
 type Err struct {
 	Error string `json:"error"`
@@ -30,6 +20,10 @@ type Err struct {
 //	Stacktrace *stacktrace-type-stacktrace*
 type Stacktrace struct {
 	Stacks []*Stack `json:"stacks"`
+
+	// Non-error messages just before the error in message history. It's set
+	// by Fromhist.
+	Context []string `json:"context,omitempty"`
 }
 
 // Stack represents a stack of stacktrace.
@@ -38,13 +32,21 @@ type Stacktrace struct {
 // vimdoc:type:
 //	Stack *stacktrace-type-stack*
 type Stack struct {
+	// Kind of the stack. "function", "lambda", "dict", "script", "autocmd",
+	// "lua", "python", "ruby" or "perl"
+	Kind FrameKind `json:"kind"`
+
 	// Function name including <SNR> for script local function
 	Funcname string `json:"funcname,omitempty"`
 
+	// Script ID and path of script local function. :h <SNR>
+	ScriptID int    `json:"script_id,omitempty"`
+	Script   string `json:"script,omitempty"`
+
 	// The line number relative to the start of the function
 	Flnum int `json:"flnum,omitempty"`
 
-	// Line text. It's empty if the func is lambda or partial
+	// Line text. It's empty if the func is partial or the source isn't found
 	Line string `json:"line,omitempty"`
 
 	// Filename is empty if func is defined in Ex-command line
@@ -55,6 +57,26 @@ type Stack struct {
 
 	// Text for quickfix or location list
 	Text string `json:"text,omitempty"`
+
+	// Type of quickfix. "E", "W" or "I" for the stack where the error occurs
+	Type string `json:"type,omitempty"`
+
+	// Autocommand event and pattern. The pattern isn't "pattern" field because
+	// it's a search pattern in quickfix.
+	Event   string `json:"event,omitempty"`
+	Pattern string `json:"autocmd_pattern,omitempty"`
+
+	// Other definitions in "file:lnum" if the function is resolved offline
+	// and the name is ambiguous
+	Candidates []string `json:"candidates,omitempty"`
+
+	// Resolution status of the stack. "ok" is omitted. "not_found",
+	// "no_file", "unreadable", "out_of_range", "stale", "malformed" or
+	// "invalid"
+	Status Status `json:"status,omitempty"`
+
+	// The reason why the stack isn't resolved
+	Error string `json:"error,omitempty"`
 }
 
 func (s *Stack) String() string {
@@ -63,7 +85,19 @@ func (s *Stack) String() string {
 
 // Vim is vim client wrapper for stacktrace pkg.
 type Vim struct {
-	c *vim.Client
+	c client
+
+	// rtp resolves functions without Vim. It's nil unless Offline.
+	rtp *rtpIndex
+
+	// cache of source files. It's created on demand.
+	cache *sourceCache
+}
+
+// client calls Vim functions. It's *vim.Client for Vim and *nvimClient for
+// Neovim.
+type client interface {
+	Call(funcname string, args ...interface{}) (vim.Body, error)
 }
 
 // Callstack returns current callstack.
@@ -81,52 +115,61 @@ func (cli *Vim) Callstack() (*Stacktrace, error) {
 
 // callstack returns callstack from <sfile> from stacktrace#callstack().
 func (cli *Vim) callstack(sfile string) (*Stacktrace, error) {
-	ss := strings.Split(sfile, "..")
+	tp, err := ParseThrowpoint(sfile)
+	if err != nil {
+		return nil, err
+	}
 	// drop last callstack because it's from stacktrace#callstack().
-	throwpoint := strings.Join(ss[:len(ss)-1], "..")
-	return cli.build(throwpoint)
+	tp.Frames = tp.Frames[:len(tp.Frames)-1]
+	return cli.build(tp)
 }
 
-var fileThrowpointRegex = regexp.MustCompile(`\[\d+]$`)
-
-// throwpoint should be normalized
-func (cli *Vim) build(throwpoint string) (*Stacktrace, error) {
-	if !strings.HasPrefix(throwpoint, "function ") {
-		if fileThrowpointRegex.MatchString(throwpoint) {
-			fname, lnum := separateStack(throwpoint)
-			e := cli.buildFileStack(fname, lnum)
-			return &Stacktrace{Stacks: []*Stack{e}}, nil
+func (cli *Vim) build(tp *Throwpoint) (*Stacktrace, error) {
+	cli = cli.prefetch(tp)
+	var es []*Stack
+	scripts := cli.scriptTable()
+	// <SNR> number to filename resolved offline
+	snrs := make(map[string]string)
+	for _, f := range tp.Frames {
+		switch f.Kind {
+		case FrameFunction, FrameLambda, FrameDict:
+			e := cli.buildFuncStack(f, scripts)
+			if e.Filename == "" && cli.rtp != nil && f.Kind == FrameFunction {
+				cli.rtp.resolve(e, snrs)
+			}
+			if e.Filename == "" && len(es) > 0 {
+				switch f.Kind {
+				case FrameLambda:
+					// freed lambda cannot be found by :function.
+					cli.resolveLambda(e, es[len(es)-1])
+				case FrameFunction:
+					cli.resolveMethod(e, es[len(es)-1])
+				}
+			}
+			es = append(es, e)
+		case FrameScript:
+			// the line of the exec chunk is relative to the call of nvim_exec2().
+			if file, lnum, ok := parseNvimExec(f.Name); ok {
+				if f.Lnum > 0 {
+					lnum += f.Lnum - 1
+				}
+				es = append(es, cli.buildFileStack(file, lnum))
+				continue
+			}
+			if f.bare && f.Lnum == 0 {
+				return nil, fmt.Errorf("invalid throwpoint: %v", tp)
+			}
+			es = append(es, cli.buildFileStack(f.Name, f.Lnum))
+		case FrameAutocmd:
+			es = append(es, cli.buildAutocmdStack(f.Event, f.Pattern))
 		}
-		return nil, fmt.Errorf("invalid throwpoint")
 	}
-
-	fileFuncLinesMu.Lock()
-	fileFuncLines = make(map[string]map[string]int)
-	fileFuncLinesMu.Unlock()
-
-	var es []*Stack
-	ss := strings.Split(throwpoint[len("function "):], "..")
-	for _, e := range ss {
-		funcname, flnum := separateStack(e)
-		es = append(es, cli.buildFuncStack(funcname, flnum))
+	if len(es) == 0 {
+		return nil, fmt.Errorf("invalid throwpoint: %v", tp)
 	}
 	return &Stacktrace{Stacks: es}, nil
 }
 
-// separateStack separates stack entry which form is body[lnum] and return (body, lnum)
-// funcname[1] -> (funcname, 1)
-// file[1] -> (file, 1)
-func separateStack(e string) (string, int) {
-	i := strings.LastIndex(e, "[")
-	body := e
-	line := 0
-	if i != -1 {
-		body = e[:i]
-		line, _ = strconv.Atoi(e[i+1 : len(e)-1])
-	}
-	return body, line
-}
-
 // Build builds rich stacktrace from given throwpoint.
 //
 // vimdoc:func:
@@ -137,118 +180,144 @@ func separateStack(e string) (string, int) {
 //			- function <SNR>13_test[1]..<SNR>13_test3, line 2
 //			- function <SNR>13_test[1]..<SNR>13_test3[2]
 //			- /path/to/file[2]
+//			- script /path/to/file.vim[12]..function F[3]..G[1]
 func (cli *Vim) Build(throwpoint string) (*Stacktrace, error) {
-	return cli.build(normalizeThrowpoint(throwpoint))
-}
-
-// function <SNR>13_test[1]..<SNR>13_test2[1]..F[3]..<lambda>1[1]..<SNR>13_test3, line 2
-// -> function <SNR>13_test[1]..<SNR>13_test3[2]
-//
-// Error detected while processing function <SNR>13_test[1]..<SNR>13_test3:
-// line    2:
-// -> function <SNR>13_test[1]..<SNR>13_test3[2]
-//
-// /path/to/file.vim, line 23
-// -> /path/to/file.vim[23]
-func normalizeThrowpoint(throwpoint string) string {
-	i := strings.Index(throwpoint, ", line ")
-	if i != -1 {
-		lnum := throwpoint[i+len(", line "):]
-		return fmt.Sprintf("%s[%s]", throwpoint[:i], lnum)
-	}
-
-	if strings.HasPrefix(throwpoint, detectedLinePrefix) {
-		throwpoint = throwpoint[len(detectedLinePrefix):]
+	tp, err := ParseThrowpoint(throwpoint)
+	if err != nil {
+		return nil, err
 	}
+	return cli.build(tp)
+}
 
-	j := strings.Index(throwpoint, ":\nline")
-	if j != -1 {
-		lnum := strings.TrimLeft(throwpoint[j+len(":\nline"):len(throwpoint)-1], " ")
-		return fmt.Sprintf("%s[%s]", throwpoint[:j], lnum)
+// BuildStrict is Build which fails if any stack is unresolved. The error is
+// *UnresolvedError and the partial stacktrace is also returned with it.
+func (cli *Vim) BuildStrict(throwpoint string) (*Stacktrace, error) {
+	stacktrace, err := cli.Build(throwpoint)
+	if err != nil {
+		return nil, err
 	}
-
-	return throwpoint
+	return stacktrace, unresolved(stacktrace)
 }
 
-var allNumRegex = regexp.MustCompile(`^\d+$`)
-
 func (cli *Vim) buildFileStack(filename string, lnum int) *Stack {
 	e := &Stack{
+		Kind:     FrameScript,
 		Filename: filename,
 		Lnum:     lnum,
 	}
-	f, err := os.Open(filename)
+	f, err := cli.sources().file(filename)
 	if err != nil {
+		e.fail(StatusUnreadable, "%v", err)
 		return e
 	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	i := 0
-	for s.Scan() {
-		i++
-		if i == lnum {
-			e.Line = s.Text()
-			e.Text = s.Text()
-			break
-		}
+	if lnum == 0 {
+		return e
 	}
-
+	l, ok := f.line(lnum)
+	if !ok {
+		e.fail(StatusOutOfRange, "line %d is out of range of %s", lnum, filename)
+		return e
+	}
+	e.Line = l
+	e.Text = l
 	return e
 }
 
-func (cli *Vim) buildFuncStack(funcname string, flnum int) *Stack {
+// buildFuncStack builds function stack. scripts is used to find the script
+// of script local function, and may be nil.
+func (cli *Vim) buildFuncStack(frame *Frame, scripts scriptTable) *Stack {
+	funcname, flnum := frame.Name, frame.Lnum
 	// convert funcname for dict func
-	if allNumRegex.MatchString(funcname) {
+	if frame.Kind == FrameDict {
 		funcname = fmt.Sprintf("{%v}", funcname)
 	}
 
 	e := &Stack{
+		Kind:     frame.Kind,
 		Funcname: funcname,
 		Flnum:    flnum,
-		Text:     fmt.Sprintf("%s:%d:", funcname, flnum),
 	}
+	if id, script, ok := scripts.lookup(funcname); ok {
+		e.ScriptID, e.Script = id, script
+	}
+	e.Text = fmt.Sprintf("%s:%d:", displayFuncname(funcname, e.Script), flnum)
 
 	f, err := cli.function(funcname)
 	if err != nil {
-		// It failse for lambda and partial
+		if !isFuncname(funcname) {
+			e.fail(StatusInvalid, "%v", err)
+			return e
+		}
+		// It failse for lambda, partial and class method
+		e.fail(StatusNotFound, "function %s is not found: %v", funcname, err)
+		if e.Script != "" {
+			cli.resolveByName(e, e.Script)
+		}
+		return e
+	}
+	listing, err := parseFuncListing(f)
+	if err != nil {
+		e.fail(StatusMalformed, "%v", err)
 		return e
 	}
-	lines := strings.Split(strings.Trim(f, "\n"), "\n")
 
 	// Get filename from Last set from ..., empty if func doen't not have Last
-	// set from
-	file := ""
-	if strings.HasPrefix(lines[1], "\tLast set from ") {
-		file = expandpath(lines[1][len("\tLast set from "):])
-		l := make([]string, 0, len(lines)-1)
-		l = append(l, lines[0])
-		l = append(l, lines[1:]...)
-		lines = l
+	// set from. The line number of the definition is also available since
+	// Vim 8.1.
+	file, deflnum := listing.file, listing.lnum
+	if file == "" {
+		// script local function is defined in the script.
+		file = e.Script
 	}
 	e.Filename = file
 
 	// Get line text
-	targeti := 0
-	for i, l := range lines {
-		if strings.HasPrefix(l, strconv.Itoa(flnum)) {
-			targeti = i
-		}
+	line, ok := listing.line(flnum)
+	if !ok {
+		e.fail(StatusOutOfRange, "line %d is not found in function %s", flnum, listing.name)
+		return e
 	}
-	lastl := lines[len(lines)-2]
-	numfield := lastl[:strings.Index(lastl, " ")]
-	e.Line = lines[targeti][len(numfield)+2:]
+	e.Line = line
 	e.Text += e.Line
 
-	if e.Filename != "" {
-		if l := cli.funcLnum(funcname, file); l > 0 {
+	if deflnum > 0 && frame.Kind == FrameLambda {
+		// lambda body starts at the line of the definition.
+		e.Lnum = deflnum + flnum - 1
+	} else if deflnum > 0 {
+		e.Lnum = deflnum + flnum
+	} else if e.Filename != "" {
+		// fallback for Vim before 8.1
+		if l := cli.funcLnum(funcname, file, listing.body); l > 0 {
 			e.Lnum = l + flnum
+		} else {
+			e.fail(StatusNotFound, "definition of %s is not found in %s", funcname, file)
 		}
+	} else {
+		e.fail(StatusNoFile, "function %s is not defined in a file", funcname)
 	}
 
+	// The body of lambda is an expression which isn't the line of the file.
+	if e.Status == StatusOK && e.Lnum > 0 && flnum > 0 && frame.Kind != FrameLambda {
+		cli.checkStale(e)
+	}
 	return e
 }
 
+// resolveByName resolves the definition of function stack e by name in file.
+// It reports whether it's found.
+func (cli *Vim) resolveByName(e *Stack, file string) bool {
+	idx := cli.funcIndex(file)
+	if idx == nil {
+		return false
+	}
+	l := idx.lookup(e.Funcname, nil)
+	if l == 0 {
+		return false
+	}
+	e.setLocation(file, l+e.Flnum, idx.lines)
+	return true
+}
+
 func expandpath(p string) string {
 	if strings.HasPrefix(p, "~/") {
 		p = strings.Replace(p, "~", homedir, 1)
@@ -256,42 +325,50 @@ func expandpath(p string) string {
 	return p
 }
 
-func (cli *Vim) funcLnum(funcname, file string) int {
-	if strings.HasPrefix(funcname, "<SNR>") {
-		funcname = "s:" + funcname[strings.Index(funcname, "_")+1:]
-	}
+// Script names of Vim which are not files. e.g. --cmd argument, modeline
+var vimNoFileRegex = regexp.MustCompile(`^(?:--cmd argument|-c argument|environment variable|error handler|modeline|changed window size|anonymous :source)$`)
 
-	fileFuncLinesMu.Lock()
-	defer fileFuncLinesMu.Unlock()
-	if funclines, ok := fileFuncLines[file]; ok {
-		return funclines[funcname]
-	}
-	f, err := os.Open(file)
-	if err != nil {
-		return 0
+// parseLastSet parses "Last set from" line of :verbose output and returns
+// filename and line number. The line number is 0 before Vim 8.1.
+// e.g. "\tLast set from /path/to/file.vim line 42" -> (/path/to/file.vim, 42)
+func parseLastSet(line string) (string, int, bool) {
+	for _, l := range msgLangs {
+		if l.lastSetRegex == nil {
+			continue
+		}
+		m := l.lastSetRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		file := m[l.lastSetRegex.SubexpIndex("file")]
+		lnum, _ := strconv.Atoi(m[l.lastSetRegex.SubexpIndex("lnum")])
+		if nvimNoFileRegex.MatchString(file) || vimNoFileRegex.MatchString(file) {
+			return "", 0, true
+		}
+		// the function defined by nvim_exec2() in Lua.
+		if f, l, ok := parseNvimExec(file); ok {
+			if lnum > 0 {
+				l += lnum - 1
+			}
+			return f, l, true
+		}
+		return expandpath(file), lnum, true
 	}
-	defer f.Close()
+	return "", 0, false
+}
 
-	node, err := vimlparser.ParseFile(f, file, &vimlparser.ParseOption{})
-	if err != nil {
+// funcLnum returns the line number of the function definition in file. body
+// is used to find numbered dict function.
+func (cli *Vim) funcLnum(funcname, file string, body map[int]string) int {
+	idx := cli.funcIndex(file)
+	if idx == nil {
 		return 0
 	}
-	fs := funcLines(node)
-	fileFuncLines[file] = fs
-	return fs[funcname]
+	return idx.lookup(funcname, body)
 }
 
-func funcLines(node ast.Node) map[string]int {
-	funcs := make(map[string]int)
-	ast.Inspect(node, func(n ast.Node) bool {
-		switch f := n.(type) {
-		case *ast.Function:
-			switch fname := f.Name.(type) {
-			case *ast.Ident:
-				funcs[fname.Name] = f.Pos().Line
-			}
-		}
-		return true
-	})
-	return funcs
+// funcIndex returns the function index of file. It returns nil if the file
+// cannot be read or parsed.
+func (cli *Vim) funcIndex(file string) *funcIndex {
+	return cli.sources().funcIndex(file)
 }
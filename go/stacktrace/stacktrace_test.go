@@ -5,7 +5,10 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -20,7 +23,14 @@ func TestVim_callstack(t *testing.T) {
 	}{
 		{
 			in:   "function F[14]..stacktrace#callstack",
-			want: &Stacktrace{Stacks: []*Stack{{Funcname: "F", Flnum: 14, Text: "F:14:"}}},
+			want: &Stacktrace{Stacks: []*Stack{{Funcname: "F", Flnum: 14, Text: "F:14:", Status: StatusNotFound, Error: notFoundErr("F")}}},
+		},
+		{
+			in: "script /path/to/file.vim[3]..function F[14]..stacktrace#callstack",
+			want: &Stacktrace{Stacks: []*Stack{
+				{Kind: FrameScript, Filename: "/path/to/file.vim", Lnum: 3, Status: StatusUnreadable, Error: "stat /path/to/file.vim: no such file or directory"},
+				{Funcname: "F", Flnum: 14, Text: "F:14:", Status: StatusNotFound, Error: notFoundErr("F")},
+			}},
 		},
 	}
 	for _, tt := range tests {
@@ -51,6 +61,8 @@ func TestVim_Build(t *testing.T) {
 						Funcname: "<SNR>13_test3",
 						Flnum:    2,
 						Text:     "<SNR>13_test3:2:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("<SNR>13_test3"),
 					},
 				},
 			},
@@ -63,16 +75,23 @@ func TestVim_Build(t *testing.T) {
 						Funcname: "F",
 						Flnum:    5,
 						Text:     "F:5:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("F"),
 					},
 					{
+						Kind:     FrameLambda,
 						Funcname: "<lambda>3",
 						Flnum:    1,
 						Text:     "<lambda>3:1:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("<lambda>3"),
 					},
 					{
 						Funcname: "<SNR>13_test3",
 						Flnum:    2,
 						Text:     "<SNR>13_test3:2:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("<SNR>13_test3"),
 					},
 				},
 			},
@@ -82,9 +101,12 @@ func TestVim_Build(t *testing.T) {
 			want: &Stacktrace{
 				Stacks: []*Stack{
 					{
+						Kind:     FrameDict,
 						Funcname: "{14}",
 						Flnum:    14,
 						Text:     "{14}:14:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("{14}"),
 					},
 				},
 			},
@@ -98,6 +120,100 @@ func TestVim_Build(t *testing.T) {
 						Funcname: "<SNR>13_test3",
 						Flnum:    0,
 						Text:     "<SNR>13_test3:0:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("<SNR>13_test3"),
+					},
+				},
+			},
+		},
+		{ // script and function frames (Vim 8.2.1297+)
+			in: "command line..script /path/to/file.vim[12]..function F[3]..G, line 2",
+			want: &Stacktrace{
+				Stacks: []*Stack{
+					{
+						Kind:     FrameScript,
+						Filename: "/path/to/file.vim",
+						Lnum:     12,
+						Status:   StatusUnreadable,
+						Error:    "stat /path/to/file.vim: no such file or directory",
+					},
+					{
+						Funcname: "F",
+						Flnum:    3,
+						Text:     "F:3:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("F"),
+					},
+					{
+						Funcname: "G",
+						Flnum:    2,
+						Text:     "G:2:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("G"),
+					},
+				},
+			},
+		},
+		{ // function called from script sourced in function
+			in: "function F[1]..script /path/to/file.vim[4]..function G[2]",
+			want: &Stacktrace{
+				Stacks: []*Stack{
+					{
+						Funcname: "F",
+						Flnum:    1,
+						Text:     "F:1:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("F"),
+					},
+					{
+						Kind:     FrameScript,
+						Filename: "/path/to/file.vim",
+						Lnum:     4,
+						Status:   StatusUnreadable,
+						Error:    "stat /path/to/file.vim: no such file or directory",
+					},
+					{
+						Funcname: "G",
+						Flnum:    2,
+						Text:     "G:2:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("G"),
+					},
+				},
+			},
+		},
+		{ // autocmd
+			in: `User Autocommands for "NotDefined"..function F[3]`,
+			want: &Stacktrace{
+				Stacks: []*Stack{
+					{
+						Kind:    FrameAutocmd,
+						Event:   "User",
+						Pattern: "NotDefined",
+						Text:    "User NotDefined:",
+						Status:  StatusNotFound,
+						Error:   "autocmd User NotDefined is not found",
+					},
+					{
+						Funcname: "F",
+						Flnum:    3,
+						Text:     "F:3:",
+						Status:   StatusNotFound,
+						Error:    notFoundErr("F"),
+					},
+				},
+			},
+		},
+		{ // Neovim's nvim_exec2() from Lua. The line 2 of the chunk is 13.
+			in: "nvim_exec2() called at /path/to/init.lua:12[2]",
+			want: &Stacktrace{
+				Stacks: []*Stack{
+					{
+						Kind:     FrameScript,
+						Filename: "/path/to/init.lua",
+						Lnum:     13,
+						Status:   StatusUnreadable,
+						Error:    "stat /path/to/init.lua: no such file or directory",
 					},
 				},
 			},
@@ -107,8 +223,11 @@ func TestVim_Build(t *testing.T) {
 			want: &Stacktrace{
 				Stacks: []*Stack{
 					{
+						Kind:     FrameScript,
 						Filename: "/path/to/file.vim",
 						Lnum:     14,
+						Status:   StatusUnreadable,
+						Error:    "stat /path/to/file.vim: no such file or directory",
 					},
 				},
 			},
@@ -128,10 +247,22 @@ func TestVim_Build(t *testing.T) {
 	}
 }
 
+// notFoundErr returns the reason of the function stack which is not found.
+func notFoundErr(funcname string) string {
+	return fmt.Sprintf("function %s is not found: %s failed", funcname, functionCmd(funcname))
+}
+
 func TestVim_Build_error(t *testing.T) {
 	v := &Vim{c: cli}
-	if got, err := v.Build("invalid"); err == nil {
-		t.Errorf("Vim.Build('invalid') = %v, but want err", got)
+	tests := []string{
+		"invalid",
+		"command line",
+		"script /path/to/file.vim[1]..G[2]",
+	}
+	for _, tt := range tests {
+		if got, err := v.Build(tt); err == nil {
+			t.Errorf("Vim.Build(%q) = %v, but want err", tt, got)
+		}
 	}
 }
 
@@ -163,11 +294,11 @@ function! s:test2() abort
   " call stacktrace#callstack()
 endfunction
 `
-	tmp, _ := ioutil.TempFile("", "vim-stacktrace-test")
-	defer tmp.Close()
-	defer os.Remove(tmp.Name())
-	tmp.WriteString(scripts)
-	filename := tmp.Name()
+	dir, _ := ioutil.TempDir("", "vim-stacktrace-test")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "plugin", "file.vim")
+	os.Mkdir(filepath.Dir(filename), 0755)
+	ioutil.WriteFile(filename, []byte(scripts), 0644)
 
 	cli, closer, err := vim.NewChildClient(&testHandler{}, vimArgs)
 	if err != nil {
@@ -175,8 +306,8 @@ endfunction
 	}
 	defer closer.Close()
 	v := &Vim{c: cli}
-	v.c.Ex(":source " + filename)
-	throwpoint, _ := v.c.Expr("g:F()")
+	cli.Ex(":source " + filename)
+	throwpoint, _ := cli.Expr("g:F()")
 	stacktrace, _ := v.Build(throwpoint.(string))
 	for _, stack := range stacktrace.Stacks {
 		if stack.Filename != "" {
@@ -186,10 +317,10 @@ endfunction
 	}
 	// Output:
 	// /path/to/file.vim:4: F:2:  return l:G()
-	// :0: <lambda>1:1:
-	// /path/to/file.vim:8: <SNR>2_test:1:  return s:d.f()
-	// /path/to/file.vim:0: {1}:1:  return s:test2()
-	// /path/to/file.vim:18: <SNR>2_test2:2:    throw 'error!'
+	// /path/to/file.vim:3: <lambda>1:1:  let l:G = {-> s:test()}
+	// /path/to/file.vim:8: s:test (plugin/file.vim):1:  return s:d.f()
+	// /path/to/file.vim:13: {1}:1:  return s:test2()
+	// /path/to/file.vim:18: s:test2 (plugin/file.vim):2:    throw 'error!'
 }
 
 func TestVim_Build_integration(t *testing.T) {
@@ -222,6 +353,17 @@ endfunction
 	tmp.WriteString(scripts)
 	filename := tmp.Name()
 
+	cli.Ex(":source " + tmp.Name())
+	throwpoint, err := cli.Expr("g:F()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := strconv.Atoi(regexp.MustCompile(`<SNR>(\d+)_`).FindStringSubmatch(throwpoint.(string))[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	snr := fmt.Sprintf("<SNR>%d_", id)
+
 	want := &Stacktrace{
 		Stacks: []*Stack{
 			{
@@ -233,45 +375,46 @@ endfunction
 				Text:     "F:2:  return l:G()",
 			},
 			{
+				Kind:     FrameLambda,
 				Funcname: "<lambda>1",
 				Flnum:    1,
-				Line:     "",
-				Filename: "",
-				Lnum:     0,
-				Text:     "<lambda>1:1:",
+				Line:     "  let l:G = {-> s:test()}",
+				Filename: filename,
+				Lnum:     3,
+				Text:     "<lambda>1:1:  let l:G = {-> s:test()}",
 			},
 			{
-				Funcname: "<SNR>2_test",
+				Funcname: snr + "test",
+				ScriptID: id,
+				Script:   filename,
 				Flnum:    1,
 				Line:     "  return s:d.f()",
 				Filename: filename,
 				Lnum:     8,
-				Text:     "<SNR>2_test:1:  return s:d.f()",
+				Text:     "s:test (" + filename + "):1:  return s:d.f()",
 			},
 			{
+				Kind:     FrameDict,
 				Funcname: "{1}",
 				Flnum:    1,
 				Line:     "  return s:test2()",
 				Filename: filename,
+				Lnum:     13,
 				Text:     "{1}:1:  return s:test2()",
 			},
 			{
-				Funcname: "<SNR>2_test2",
+				Funcname: snr + "test2",
+				ScriptID: id,
+				Script:   filename,
 				Flnum:    1,
 				Line:     `  return printf('%s[%s]', expand('<sfile>'), expand('<slnum>'))`,
 				Filename: filename,
 				Lnum:     17,
-				Text:     `<SNR>2_test2:1:  return printf('%s[%s]', expand('<sfile>'), expand('<slnum>'))`,
+				Text:     "s:test2 (" + filename + `):1:  return printf('%s[%s]', expand('<sfile>'), expand('<slnum>'))`,
 			},
 		},
 	}
 
-	v.c.Ex(":source " + tmp.Name())
-	throwpoint, err := v.c.Expr("g:F()")
-	if err != nil {
-		t.Fatal(err)
-	}
-
 	got, err := v.Build(throwpoint.(string))
 	if err != nil {
 		t.Fatal(err)
@@ -286,6 +429,51 @@ endfunction
 	}
 }
 
+func TestVim_buildFuncStack_lastSetLine(t *testing.T) {
+	scripts := `
+let s:d = {}
+function! s:d.f() abort
+  return 1
+endfunction
+function! VimStacktraceTestLastSetLine() abort
+  return 1
+endfunction
+let g:vim_stacktrace_test_d = s:d
+`
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.WriteString(scripts)
+	tmp.Close()
+	filename := tmp.Name()
+
+	v := &Vim{c: cli}
+	// use execute() instead of cli.Ex to wait execution
+	if _, err := cli.Call("execute", ":source "+filename); err != nil {
+		t.Fatal(err)
+	}
+	// The line number is available without the source file since Vim 8.1.
+	os.Remove(filename)
+
+	dictfunc, err := cli.Expr("get(g:vim_stacktrace_test_d.f, 'name')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		frame *Frame
+		want  int
+	}{
+		{frame: &Frame{Kind: FrameFunction, Name: "VimStacktraceTestLastSetLine", Lnum: 1}, want: 7},
+		{frame: &Frame{Kind: FrameDict, Name: dictfunc.(string), Lnum: 1}, want: 4},
+	}
+	for _, tt := range tests {
+		if got := v.buildFuncStack(tt.frame, nil); got.Lnum != tt.want || got.Filename != filename {
+			t.Errorf("Vim.buildFuncStack(%v) = %#v, want Lnum %v", tt.frame, got, tt.want)
+		}
+	}
+}
+
 func TestVim_buildFileStack(t *testing.T) {
 	v := &Vim{c: cli}
 	scripts := `line1
@@ -306,8 +494,8 @@ line3
 		lnum int
 		want *Stack
 	}{
-		{lnum: 1, want: &Stack{Lnum: 1, Line: "line1", Text: "line1", Filename: filename}},
-		{lnum: 4, want: &Stack{Lnum: 4, Line: "   line4", Text: "   line4", Filename: filename}},
+		{lnum: 1, want: &Stack{Kind: FrameScript, Lnum: 1, Line: "line1", Text: "line1", Filename: filename}},
+		{lnum: 4, want: &Stack{Kind: FrameScript, Lnum: 4, Line: "   line4", Text: "   line4", Filename: filename}},
 	}
 	for _, tt := range tests {
 		if got := v.buildFileStack(filename, tt.lnum); !reflect.DeepEqual(got, tt.want) {
@@ -315,78 +503,41 @@ line3
 		}
 	}
 
-}
-
-func TestSeparateStack(t *testing.T) {
-	tests := []struct {
-		in       string
-		wantBody string
-		wantLnum int
-	}{
-		{
-			in:       "<SNR>13_test[1]",
-			wantBody: "<SNR>13_test",
-			wantLnum: 1,
-		},
-		{
-			in:       "<lambda>3[1]",
-			wantBody: "<lambda>3",
-			wantLnum: 1,
-		},
-		{
-			in:       "F[100]",
-			wantBody: "F",
-			wantLnum: 100,
-		},
-		{
-			in:       "/path/to/file[14]",
-			wantBody: "/path/to/file",
-			wantLnum: 14,
-		},
-		{
-			in:       "[14].vim[24]",
-			wantBody: "[14].vim",
-			wantLnum: 24,
-		},
-		{
-			in:       "<SNR>14_nolnum",
-			wantBody: "<SNR>14_nolnum",
-			wantLnum: 0,
-		},
+	// the line of nvim_exec2() chunk is relative to the line which calls it.
+	got, err := v.Build(fmt.Sprintf("nvim_exec2() called at %s:2[3]", filename))
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, tt := range tests {
-		if gotBody, gotLnum := separateStack(tt.in); gotBody != tt.wantBody || gotLnum != tt.wantLnum {
-			t.Errorf("separateStack(%v) = (%v, %v), want (%v, %v)", tt.in, gotBody, gotLnum, tt.wantBody, tt.wantLnum)
-		}
+	want := &Stack{Kind: FrameScript, Lnum: 4, Line: "   line4", Text: "   line4", Filename: filename}
+	if len(got.Stacks) != 1 || !reflect.DeepEqual(got.Stacks[0], want) {
+		t.Errorf("Vim.Build(nvim_exec2()) = %#+v, want %#+v", got.Stacks, want)
 	}
 }
 
-func TestNormalizeThrowpoint(t *testing.T) {
+func TestParseLastSet(t *testing.T) {
 	tests := []struct {
-		in   string
-		want string
+		in       string
+		wantFile string
+		wantLnum int
+		wantOK   bool
 	}{
-		{ // v:throwpoint
-			in:   "function <SNR>13_test[1]..<SNR>13_test3, line 2",
-			want: "function <SNR>13_test[1]..<SNR>13_test3[2]",
-		},
-		{ // :throw message
-			in:   "Error detected while processing function <SNR>13_test[1]..<SNR>13_test3:\nline    2:",
-			want: "function <SNR>13_test[1]..<SNR>13_test3[2]",
-		},
-		{ // v:throwpoint
-			in:   "/path/to/file.vim, line 23",
-			want: "/path/to/file.vim[23]",
-		},
+		{in: "\tLast set from /path/to/file.vim line 42", wantFile: "/path/to/file.vim", wantLnum: 42, wantOK: true},
+		{in: "\tLast set from /path/to/file.vim", wantFile: "/path/to/file.vim", wantOK: true},
+		{in: "\tLast set from /path/to/a line 1.vim line 2", wantFile: "/path/to/a line 1.vim", wantLnum: 2, wantOK: true},
+		{in: "\t最後にセットしたスクリプト: /path/to/file.vim 行 42", wantFile: "/path/to/file.vim", wantLnum: 42, wantOK: true},
+		{in: "\tZuletzt gesetzt in /path/to/file.vim Zeile 3", wantFile: "/path/to/file.vim", wantLnum: 3, wantOK: true},
+		{in: "\tDefinido pela última vez em /path/to/file.vim line 3", wantFile: "/path/to/file.vim", wantLnum: 3, wantOK: true},
+		{in: "\tLast set from Lua (run Nvim with -V1 for more details)", wantOK: true},
+		{in: "\tLast set from API client (channel id 3) line 1", wantOK: true},
+		{in: "\tLast set from --cmd argument line 2", wantOK: true},
+		{in: "\tLast set from modeline", wantOK: true},
+		{in: "\tLast set from nvim_exec2() called at /path/to/init.lua:10 line 2", wantFile: "/path/to/init.lua", wantLnum: 11, wantOK: true},
+		{in: "1  return 1"},
 	}
-
 	for _, tt := range tests {
-		got := normalizeThrowpoint(tt.in)
-		if got != tt.want {
-			t.Errorf("normalizeThrowpoint(%v) = %v, tt.want %v", tt.in, got, tt.want)
-		}
-		if got2 := normalizeThrowpoint(got); got2 != tt.want {
-			t.Errorf("normalizeThrowpoint(%v) = %v, tt.want %v", got, got2, tt.want)
+		file, lnum, ok := parseLastSet(tt.in)
+		if file != tt.wantFile || lnum != tt.wantLnum || ok != tt.wantOK {
+			t.Errorf("parseLastSet(%q) = (%v, %v, %v), want (%v, %v, %v)", tt.in, file, lnum, ok, tt.wantFile, tt.wantLnum, tt.wantOK)
 		}
 	}
 }
@@ -404,12 +555,27 @@ function! F() abort
 endfunction
 function! s:f() abort
 endfunction
+function! g:G() abort
+endfunction
+function! <SID>g() abort
+endfunction
+function! foo#bar() abort
+endfunction
+let s:obj = {}
+function! s:obj.method() dict abort
+  return 'method'
+endfunction
+function! s:obj.method2() dict abort
+  return 'method2'
+endfunction
+function! s:{'curly'}_f() abort
+endfunction
 `
-	tmp, _ := ioutil.TempFile("", "vim-stacktrace-test")
-	defer tmp.Close()
-	defer os.Remove(tmp.Name())
-	tmp.WriteString(scripts)
-	filename := tmp.Name()
+	dir, _ := ioutil.TempDir("", "vim-stacktrace-test")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "plugin", "file.vim")
+	os.Mkdir(filepath.Dir(filename), 0755)
+	ioutil.WriteFile(filename, []byte(scripts), 0644)
 
 	cli, closer, err := vim.NewChildClient(&testHandler{}, vimArgs)
 	if err != nil {
@@ -419,16 +585,24 @@ endfunction
 	v := &Vim{c: cli}
 	tests := []struct {
 		funcname, filename string
+		body               map[int]string
 		want               int
 	}{
-		{"F", "notfound.txt", 0},
-		{"s:f", filename, 4},
-		{"<SNR>14_f", filename, 4},
-		{"<SNR>f", filename, 0},
+		{"F", "notfound.txt", nil, 0},
+		{"s:f", filename, nil, 4},
+		{"<SNR>14_f", filename, nil, 4},
+		{"<SNR>f", filename, nil, 0},
+		{"G", filename, nil, 6},
+		{"<SNR>14_g", filename, nil, 8},
+		{"foo#bar", filename, nil, 10},
+		{"{1}", filename, map[int]string{1: "  return 'method'"}, 13},
+		{"2", filename, map[int]string{1: "  return 'method2'"}, 16},
+		{"{3}", filename, map[int]string{1: "  return 'notfound'"}, 0},
+		{"<SNR>14_curly_f", filename, nil, 19},
 	}
 	for _, tt := range tests {
-		if got := v.funcLnum(tt.funcname, tt.filename); got != tt.want {
-			t.Errorf("Vim.funcLnum(%v, %v) = %v, got %v", tt.funcname, tt.filename, got, tt.want)
+		if got := v.funcLnum(tt.funcname, tt.filename, tt.body); got != tt.want {
+			t.Errorf("Vim.funcLnum(%v, %v, %v) = %v, want %v", tt.funcname, tt.filename, tt.body, got, tt.want)
 		}
 	}
 }
@@ -442,7 +616,7 @@ func TestVim_funcLnum_parseerror(t *testing.T) {
 	filename := tmp.Name()
 	v := &Vim{c: cli}
 	want := 0
-	if got := v.funcLnum("F", filename); got != want {
+	if got := v.funcLnum("F", filename, nil); got != want {
 		t.Errorf("Vim.funcLnum(%v, %v) = %v, got %v", "F", filename, got, want)
 	}
 }
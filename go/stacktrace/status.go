@@ -0,0 +1,122 @@
+package stacktrace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Status represents how a stack is resolved. The reason of unresolved stack
+// is in Stack.Error.
+type Status int
+
+const (
+	// StatusOK is a resolved stack.
+	StatusOK Status = iota
+	// StatusNotFound is the stack whose function or autocmd is not found.
+	StatusNotFound
+	// StatusNoFile is the stack whose definition isn't in a file. e.g. the
+	// function defined in command line, freed lambda
+	StatusNoFile
+	// StatusUnreadable is the stack whose file cannot be read.
+	StatusUnreadable
+	// StatusOutOfRange is the stack whose line number is out of the function
+	// or the file.
+	StatusOutOfRange
+	// StatusStale is the stack whose file has been changed since it was
+	// sourced.
+	StatusStale
+	// StatusMalformed is the stack whose definition from Vim is unexpected.
+	StatusMalformed
+	// StatusInvalid is the stack rejected as invalid. e.g. the function name
+	// which isn't valid
+	StatusInvalid
+)
+
+var statusNames = [...]string{
+	StatusOK:         "ok",
+	StatusNotFound:   "not_found",
+	StatusNoFile:     "no_file",
+	StatusUnreadable: "unreadable",
+	StatusOutOfRange: "out_of_range",
+	StatusStale:      "stale",
+	StatusMalformed:  "malformed",
+	StatusInvalid:    "invalid",
+}
+
+func (s Status) String() string {
+	if 0 <= int(s) && int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return "Status(" + strconv.Itoa(int(s)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Status) MarshalText() ([]byte, error) {
+	if 0 <= int(s) && int(s) < len(statusNames) {
+		return []byte(statusNames[s]), nil
+	}
+	return nil, fmt.Errorf("invalid status: %d", int(s))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Status) UnmarshalText(text []byte) error {
+	for i, name := range statusNames {
+		if name == string(text) {
+			*s = Status(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status: %q", text)
+}
+
+// fail marks e as unresolved with the reason.
+func (e *Stack) fail(status Status, format string, args ...interface{}) {
+	e.Status = status
+	e.Error = fmt.Sprintf(format, args...)
+}
+
+// setLocation sets the location of e resolved from the source lines and
+// clears the unresolved status.
+func (e *Stack) setLocation(file string, lnum int, lines []string) {
+	e.Filename = file
+	e.Lnum = lnum
+	e.Status, e.Error = StatusOK, ""
+	if e.Line != "" {
+		return
+	}
+	if lnum < 1 || len(lines) < lnum {
+		e.fail(StatusOutOfRange, "line %d is out of range of %s", lnum, file)
+		return
+	}
+	e.Line = lines[lnum-1]
+	e.Text += e.Line
+}
+
+// UnresolvedError is the error of Vim.BuildStrict which has unresolved
+// stacks.
+type UnresolvedError struct {
+	Stacks []*Stack
+}
+
+func (err *UnresolvedError) Error() string {
+	ss := make([]string, 0, len(err.Stacks))
+	for _, e := range err.Stacks {
+		ss = append(ss, fmt.Sprintf("%s (%s: %s)", e.Text, e.Status, e.Error))
+	}
+	return fmt.Sprintf("%d unresolved stacks: %s", len(err.Stacks), strings.Join(ss, ", "))
+}
+
+// unresolved returns an error if stacktrace has unresolved stacks.
+func unresolved(stacktrace *Stacktrace) error {
+	var es []*Stack
+	for _, e := range stacktrace.Stacks {
+		if e.Status != StatusOK {
+			es = append(es, e)
+		}
+	}
+	if len(es) == 0 {
+		return nil
+	}
+	return &UnresolvedError{Stacks: es}
+}
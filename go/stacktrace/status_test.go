@@ -0,0 +1,50 @@
+package stacktrace
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStatus_MarshalText(t *testing.T) {
+	for s := StatusOK; s <= StatusInvalid; s++ {
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Status
+		if err := json.Unmarshal(b, &got); err != nil || got != s {
+			t.Errorf("json round trip of %v = %v, %v", s, got, err)
+		}
+	}
+	if _, err := json.Marshal(Status(100)); err == nil {
+		t.Error("Status(100) should not be marshaled")
+	}
+	// resolved stack doesn't have status.
+	b, _ := json.Marshal(&Stack{Text: "F:1:"})
+	if got, want := string(b), `{"kind":"function","text":"F:1:"}`; got != want {
+		t.Errorf("json.Marshal(Stack) = %s, want %s", got, want)
+	}
+}
+
+func TestVim_BuildStrict(t *testing.T) {
+	v := &Vim{c: cli}
+	if _, err := cli.Call("execute", "function! StrictF()\nreturn 1\nendfunction"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := v.BuildStrict("function StrictF[1]..NotDefined[1]")
+	uerr, ok := err.(*UnresolvedError)
+	if !ok {
+		t.Fatalf("Vim.BuildStrict() error = %v, want *UnresolvedError", err)
+	}
+	if len(got.Stacks) != 2 {
+		t.Errorf("Vim.BuildStrict() returns %d stacks, want 2", len(got.Stacks))
+	}
+	if len(uerr.Stacks) != 2 || uerr.Stacks[0].Status != StatusNoFile || uerr.Stacks[1].Status != StatusNotFound {
+		t.Errorf("unresolved stacks: %v", uerr)
+	}
+
+	got, err = v.BuildStrict("function <SNR>1_undefined[1]")
+	if err == nil {
+		t.Errorf("Vim.BuildStrict() = %v, want error", got)
+	}
+}
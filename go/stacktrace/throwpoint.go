@@ -0,0 +1,356 @@
+package stacktrace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FrameKind represents a kind of throwpoint frame.
+type FrameKind int
+
+const (
+	// FrameFunction is a user function frame. e.g. F[3], <SNR>13_test[1]
+	FrameFunction FrameKind = iota
+	// FrameLambda is a lambda or closure frame. e.g. <lambda>3[1]
+	FrameLambda
+	// FrameDict is a numbered dict function frame. e.g. 14[2]
+	FrameDict
+	// FrameScript is a sourced script frame. e.g. script /path/to/file.vim[12]
+	FrameScript
+	// FrameAutocmd is an autocommand frame.
+	// e.g. BufWritePost Autocommands for "*.go"
+	FrameAutocmd
+	// FrameCmdline is a command line frame. e.g. command line
+	FrameCmdline
+	// FrameLua is a Lua function frame in Neovim's stack traceback. It's not
+	// in throwpoint. e.g. /path/to/foo.lua:12: in function 'bar'
+	FrameLua
+	// FramePython, FrameRuby and FramePerl are frames in traceback of the
+	// language interfaces. :h python3, :h ruby, :h perl
+	FramePython
+	FrameRuby
+	FramePerl
+)
+
+var frameKindNames = [...]string{
+	FrameFunction: "function",
+	FrameLambda:   "lambda",
+	FrameDict:     "dict",
+	FrameScript:   "script",
+	FrameAutocmd:  "autocmd",
+	FrameCmdline:  "cmdline",
+	FrameLua:      "lua",
+	FramePython:   "python",
+	FrameRuby:     "ruby",
+	FramePerl:     "perl",
+}
+
+func (k FrameKind) String() string {
+	if 0 <= int(k) && int(k) < len(frameKindNames) {
+		return frameKindNames[k]
+	}
+	return "FrameKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k FrameKind) MarshalText() ([]byte, error) {
+	if 0 <= int(k) && int(k) < len(frameKindNames) {
+		return []byte(frameKindNames[k]), nil
+	}
+	return nil, fmt.Errorf("invalid frame kind: %d", int(k))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *FrameKind) UnmarshalText(text []byte) error {
+	for i, name := range frameKindNames {
+		if name == string(text) {
+			*k = FrameKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown frame kind: %q", text)
+}
+
+// isFunc reports whether the frame is a function call, which follows
+// "function " prefix in throwpoint.
+func (k FrameKind) isFunc() bool {
+	return k == FrameFunction || k == FrameLambda || k == FrameDict
+}
+
+// Frame represents a frame of throwpoint.
+type Frame struct {
+	Kind FrameKind
+
+	// Function name or script path. It's empty for autocmd and command line.
+	Name string
+
+	// Autocommand event and pattern.
+	// e.g. BufWritePost, *.go
+	Event   string
+	Pattern string
+
+	// The line number relative to the start of the function or the script.
+	// It's 0 if unknown.
+	Lnum int
+
+	// bare is true for script frame without "script " prefix, which is the
+	// format before Vim 8.2.1297 or nested :source.
+	// e.g. /path/to/file.vim[14], script /a.vim[1]../b.vim[2]
+	bare bool
+}
+
+// String returns the frame in Vim's format without "function " prefix.
+func (f *Frame) String() string {
+	var s string
+	switch f.Kind {
+	case FrameScript:
+		s = f.Name
+		if !f.bare {
+			s = scriptFramePrefix + s
+		}
+	case FrameAutocmd:
+		s = fmt.Sprintf("%s%s%s\"", f.Event, autocmdFrameInfix, f.Pattern)
+	case FrameCmdline:
+		s = cmdlineFrame
+	default:
+		s = f.Name
+	}
+	if f.Lnum > 0 {
+		s += "[" + strconv.Itoa(f.Lnum) + "]"
+	}
+	return s
+}
+
+// Throwpoint represents a parsed throwpoint similar to v:throwpoint.
+type Throwpoint struct {
+	Frames []*Frame
+}
+
+// String returns the throwpoint in Vim's format. The line number is always
+// written as [lnum] like expand('<stack>').
+// e.g. command line..script /path/to/file.vim[12]..function F[3]..G[1]
+func (tp *Throwpoint) String() string {
+	ss := make([]string, 0, len(tp.Frames))
+	for i, f := range tp.Frames {
+		s := f.String()
+		if f.Kind.isFunc() && (i == 0 || !tp.Frames[i-1].Kind.isFunc()) {
+			s = funcFramePrefix + s
+		}
+		ss = append(ss, s)
+	}
+	return strings.Join(ss, frameSep)
+}
+
+const (
+	frameSep          = ".."
+	funcFramePrefix   = "function "
+	scriptFramePrefix = "script "
+	cmdlineFrame      = "command line"
+	autocmdFrameInfix = ` Autocommands for "`
+)
+
+var (
+	frameLnumRegex = regexp.MustCompile(`^\[(\d+)]`)
+	allNumRegex    = regexp.MustCompile(`^\d+$`)
+)
+
+// ParseThrowpoint parses throwpoint such as v:throwpoint, expand('<stack>')
+// and the throwpoint part of error messages.
+// e.g.
+//
+//	function <SNR>13_test[1]..<SNR>13_test3, line 2
+//	command line..script /path/to/file.vim[12]..function F[3]..G[1]
+//	Error detected while processing function <SNR>13_test[1]..F:\nline    2:
+//	/path/to/file.vim, line 23
+//
+// The messages translated by :language messages are also supported.
+func ParseThrowpoint(throwpoint string) (*Throwpoint, error) {
+	s := normalizeThrowpoint(throwpoint)
+	if s == "" {
+		return nil, fmt.Errorf("invalid throwpoint: empty")
+	}
+
+	tp := &Throwpoint{}
+	infunc := false
+	for {
+		var (
+			f    *Frame
+			rest string
+			err  error
+		)
+		switch {
+		case strings.HasPrefix(s, cmdlineFrame) && isFrameEnd(s[len(cmdlineFrame):]):
+			f, rest = &Frame{Kind: FrameCmdline}, s[len(cmdlineFrame):]
+			infunc = false
+		case strings.HasPrefix(s, scriptFramePrefix):
+			f, rest = parseScriptFrame(s[len(scriptFramePrefix):])
+			infunc = false
+		case isAutocmdFrame(s):
+			f, rest, err = parseAutocmdFrame(s)
+			infunc = false
+		case strings.HasPrefix(s, funcFramePrefix):
+			f, rest, err = parseFuncFrame(s[len(funcFramePrefix):])
+			infunc = true
+		case infunc:
+			f, rest, err = parseFuncFrame(s)
+		case len(tp.Frames) == 0:
+			f, rest = parseScriptFrame(s)
+			f.bare = true
+		case tp.Frames[len(tp.Frames)-1].Kind == FrameScript:
+			// nested :source doesn't have "script " prefix.
+			f, rest = parseScriptFrame(s)
+			f.bare = true
+			if !strings.ContainsAny(f.Name, `/\`) {
+				err = fmt.Errorf("unexpected frame: %q", s)
+			}
+		default:
+			err = fmt.Errorf("unexpected frame: %q", s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid throwpoint %q: %v", throwpoint, err)
+		}
+		tp.Frames = append(tp.Frames, f)
+		if rest == "" {
+			return tp, nil
+		}
+		s = rest[len(frameSep):]
+	}
+}
+
+// isFrameEnd reports whether s is the rest of throwpoint after a frame.
+func isFrameEnd(s string) bool {
+	return s == "" || strings.HasPrefix(s, frameSep)
+}
+
+// isFrameStart reports whether s starts with a prefixed frame.
+func isFrameStart(s string) bool {
+	return strings.HasPrefix(s, funcFramePrefix) ||
+		strings.HasPrefix(s, scriptFramePrefix) ||
+		(strings.HasPrefix(s, cmdlineFrame) && isFrameEnd(s[len(cmdlineFrame):])) ||
+		isAutocmdFrame(s)
+}
+
+// parseLnum parses optional [lnum] followed by the end of frame.
+func parseLnum(s string) (lnum int, rest string, ok bool) {
+	if m := frameLnumRegex.FindStringSubmatch(s); m != nil && isFrameEnd(s[len(m[0]):]) {
+		lnum, _ = strconv.Atoi(m[1])
+		return lnum, s[len(m[0]):], true
+	}
+	return 0, s, isFrameEnd(s)
+}
+
+// parseScriptFrame parses a script path which may contain "..", "[" and
+// ", line ". The path ends at [lnum] followed by the end of frame or at ".."
+// followed by a prefixed frame.
+func parseScriptFrame(s string) (*Frame, string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			if lnum, rest, ok := parseLnum(s[i:]); ok {
+				return &Frame{Kind: FrameScript, Name: s[:i], Lnum: lnum}, rest
+			}
+		case '.':
+			if strings.HasPrefix(s[i:], frameSep) && isFrameStart(s[i+len(frameSep):]) {
+				return &Frame{Kind: FrameScript, Name: s[:i]}, s[i:]
+			}
+		}
+	}
+	return &Frame{Kind: FrameScript, Name: s}, ""
+}
+
+// normalizeThrowpoint converts the line number of throwpoint to [lnum].
+//
+//	function <SNR>13_test[1]..<SNR>13_test3, line 2
+//	-> function <SNR>13_test[1]..<SNR>13_test3[2]
+//
+//	Error detected while processing function <SNR>13_test[1]..<SNR>13_test3:
+//	line    2:
+//	-> function <SNR>13_test[1]..<SNR>13_test3[2]
+func normalizeThrowpoint(throwpoint string) string {
+	if i := strings.IndexByte(throwpoint, '\n'); i != -1 {
+		if tp, l, ok := parseDetected(throwpoint[:i]); ok {
+			if lnum, ok := l.parseDetectedLine(throwpoint[i+1:]); ok {
+				return tp + "[" + lnum + "]"
+			}
+		}
+		return throwpoint
+	}
+	if tp, _, ok := parseDetected(throwpoint); ok {
+		return tp
+	}
+	for _, l := range msgLangs {
+		if l.throwpointLineRegex == nil {
+			continue
+		}
+		if m := l.throwpointLineRegex.FindStringSubmatch(throwpoint); m != nil {
+			return m[l.throwpointLineRegex.SubexpIndex("throwpoint")] +
+				"[" + m[l.throwpointLineRegex.SubexpIndex("lnum")] + "]"
+		}
+	}
+	return throwpoint
+}
+
+// isAutocmdFrame reports whether s starts with autocmd frame.
+func isAutocmdFrame(s string) bool {
+	_, _, ok := matchAutocmdFrame(s)
+	return ok
+}
+
+// matchAutocmdFrame matches autocmd frame until the opening quote of the
+// pattern and returns the event and the rest.
+func matchAutocmdFrame(s string) (event string, rest string, ok bool) {
+	for _, l := range msgLangs {
+		if l.autocmdRegex == nil {
+			continue
+		}
+		if m := l.autocmdRegex.FindStringSubmatch(s); m != nil {
+			return m[l.autocmdRegex.SubexpIndex("event")], s[len(m[0]):], true
+		}
+	}
+	return "", "", false
+}
+
+// parseAutocmdFrame parses autocmd frame.
+// e.g. BufWritePost Autocommands for "*.go"
+func parseAutocmdFrame(s string) (*Frame, string, error) {
+	event, pat, _ := matchAutocmdFrame(s)
+	for i := 0; i < len(pat); i++ {
+		if pat[i] != '"' {
+			continue
+		}
+		if lnum, rest, ok := parseLnum(pat[i+1:]); ok {
+			return &Frame{Kind: FrameAutocmd, Event: event, Pattern: pat[:i], Lnum: lnum}, rest, nil
+		}
+	}
+	return nil, "", fmt.Errorf("unterminated autocmd pattern: %q", s)
+}
+
+// parseFuncFrame parses function frame. Function name doesn't contain "["
+// nor "..".
+func parseFuncFrame(s string) (*Frame, string, error) {
+	i := strings.IndexByte(s, '[')
+	if j := strings.Index(s, frameSep); j != -1 && (i == -1 || j < i) {
+		i = j
+	}
+	if i == -1 {
+		i = len(s)
+	}
+	name := s[:i]
+	if name == "" {
+		return nil, "", fmt.Errorf("function name is empty: %q", s)
+	}
+	lnum, rest, ok := parseLnum(s[i:])
+	if !ok {
+		return nil, "", fmt.Errorf("invalid function frame: %q", s)
+	}
+	f := &Frame{Kind: FrameFunction, Name: name, Lnum: lnum}
+	switch {
+	case strings.HasPrefix(name, "<lambda>"):
+		f.Kind = FrameLambda
+	case allNumRegex.MatchString(name):
+		f.Kind = FrameDict
+	}
+	return f, rest, nil
+}
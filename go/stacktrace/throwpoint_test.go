@@ -0,0 +1,186 @@
+package stacktrace
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseThrowpoint(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *Throwpoint
+		// String() of parsed throwpoint
+		wantString string
+	}{
+		{ // v:throwpoint
+			in: "function <SNR>13_test[1]..<SNR>13_test3, line 2",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameFunction, Name: "<SNR>13_test", Lnum: 1},
+				{Kind: FrameFunction, Name: "<SNR>13_test3", Lnum: 2},
+			}},
+			wantString: "function <SNR>13_test[1]..<SNR>13_test3[2]",
+		},
+		{ // :throw message
+			in: "Error detected while processing function <SNR>13_test[1]..<SNR>13_test3:\nline    2:",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameFunction, Name: "<SNR>13_test", Lnum: 1},
+				{Kind: FrameFunction, Name: "<SNR>13_test3", Lnum: 2},
+			}},
+			wantString: "function <SNR>13_test[1]..<SNR>13_test3[2]",
+		},
+		{
+			in: "function F[5]..<lambda>3[1]..14[2]..<SNR>14_nolnum",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameFunction, Name: "F", Lnum: 5},
+				{Kind: FrameLambda, Name: "<lambda>3", Lnum: 1},
+				{Kind: FrameDict, Name: "14", Lnum: 2},
+				{Kind: FrameFunction, Name: "<SNR>14_nolnum"},
+			}},
+			wantString: "function F[5]..<lambda>3[1]..14[2]..<SNR>14_nolnum",
+		},
+		{ // file (before Vim 8.2.1297)
+			in: "/path/to/file.vim, line 23",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameScript, Name: "/path/to/file.vim", Lnum: 23, bare: true},
+			}},
+			wantString: "/path/to/file.vim[23]",
+		},
+		{
+			in: "[14].vim[24]",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameScript, Name: "[14].vim", Lnum: 24, bare: true},
+			}},
+			wantString: "[14].vim[24]",
+		},
+		{ // expand('<stack>')
+			in: "command line..script /path/to/file.vim[12]..function F[3]..G[1]",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameCmdline},
+				{Kind: FrameScript, Name: "/path/to/file.vim", Lnum: 12},
+				{Kind: FrameFunction, Name: "F", Lnum: 3},
+				{Kind: FrameFunction, Name: "G", Lnum: 1},
+			}},
+			wantString: "command line..script /path/to/file.vim[12]..function F[3]..G[1]",
+		},
+		{ // path contains "..", "[" and ", line "
+			in: "script /path/../a[1]/b, line 1.vim[2]..function F, line 3",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameScript, Name: "/path/../a[1]/b, line 1.vim", Lnum: 2},
+				{Kind: FrameFunction, Name: "F", Lnum: 3},
+			}},
+			wantString: "script /path/../a[1]/b, line 1.vim[2]..function F[3]",
+		},
+		{
+			in: "script /path/../file.vim..function F[3]",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameScript, Name: "/path/../file.vim"},
+				{Kind: FrameFunction, Name: "F", Lnum: 3},
+			}},
+			wantString: "script /path/../file.vim..function F[3]",
+		},
+		{
+			in: `command line..script /path/to/file.vim[29]..BufWritePost Autocommands for "*.go"..function go#fmt#Format[12]..<SNR>3_f, line 1`,
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameCmdline},
+				{Kind: FrameScript, Name: "/path/to/file.vim", Lnum: 29},
+				{Kind: FrameAutocmd, Event: "BufWritePost", Pattern: "*.go"},
+				{Kind: FrameFunction, Name: "go#fmt#Format", Lnum: 12},
+				{Kind: FrameFunction, Name: "<SNR>3_f", Lnum: 1},
+			}},
+			wantString: `command line..script /path/to/file.vim[29]..BufWritePost Autocommands for "*.go"..function go#fmt#Format[12]..<SNR>3_f[1]`,
+		},
+		{ // nested :source
+			in: "command line..script /path/to/a.vim[1]../path/to/b.vim[33]..function <SNR>2_Foo[2]..<SNR>2_Bar, line 1",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameCmdline},
+				{Kind: FrameScript, Name: "/path/to/a.vim", Lnum: 1},
+				{Kind: FrameScript, Name: "/path/to/b.vim", Lnum: 33, bare: true},
+				{Kind: FrameFunction, Name: "<SNR>2_Foo", Lnum: 2},
+				{Kind: FrameFunction, Name: "<SNR>2_Bar", Lnum: 1},
+			}},
+			wantString: "command line..script /path/to/a.vim[1]../path/to/b.vim[33]..function <SNR>2_Foo[2]..<SNR>2_Bar[1]",
+		},
+		{ // Vim9 class method
+			in: "script /path/to/file.vim[37]..function <SNR>2_Cls.Method[1]..Method[2]",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameScript, Name: "/path/to/file.vim", Lnum: 37},
+				{Kind: FrameFunction, Name: "<SNR>2_Cls.Method", Lnum: 1},
+				{Kind: FrameFunction, Name: "Method", Lnum: 2},
+			}},
+			wantString: "script /path/to/file.vim[37]..function <SNR>2_Cls.Method[1]..Method[2]",
+		},
+		{ // Vim9 compile error
+			in: "Error detected while compiling command line..script /path/to/file.vim[8]..function <SNR>1_CallBroken[1]..<SNR>1_Broken:\nline    1:",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameCmdline},
+				{Kind: FrameScript, Name: "/path/to/file.vim", Lnum: 8},
+				{Kind: FrameFunction, Name: "<SNR>1_CallBroken", Lnum: 1},
+				{Kind: FrameFunction, Name: "<SNR>1_Broken", Lnum: 1},
+			}},
+			wantString: "command line..script /path/to/file.vim[8]..function <SNR>1_CallBroken[1]..<SNR>1_Broken[1]",
+		},
+		{ // v:throwpoint in :language messages ja_JP.UTF-8
+			in: "function F[1]..G, 行 2",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameFunction, Name: "F", Lnum: 1},
+				{Kind: FrameFunction, Name: "G", Lnum: 2},
+			}},
+			wantString: "function F[1]..G[2]",
+		},
+		{ // v:throwpoint in :language messages zh_CN.UTF-8
+			in: `script /path/to/file.vim[3]..User 自动命令 "Foo"..function G，第 2 行`,
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameScript, Name: "/path/to/file.vim", Lnum: 3},
+				{Kind: FrameAutocmd, Event: "User", Pattern: "Foo"},
+				{Kind: FrameFunction, Name: "G", Lnum: 2},
+			}},
+			wantString: `script /path/to/file.vim[3]..User Autocommands for "Foo"..function G[2]`,
+		},
+		{ // :throw message in :language messages de_DE.UTF-8
+			in: "Fehler beim Ausführen von \"function F\":\nZeile    2:",
+			want: &Throwpoint{Frames: []*Frame{
+				{Kind: FrameFunction, Name: "F", Lnum: 2},
+			}},
+			wantString: "function F[2]",
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseThrowpoint(tt.in)
+		if err != nil {
+			t.Errorf("ParseThrowpoint(%q) got an unexpected error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseThrowpoint(%q):", tt.in)
+			for _, f := range got.Frames {
+				t.Logf("got : %#v", f)
+			}
+			for _, f := range tt.want.Frames {
+				t.Logf("want: %#v", f)
+			}
+		}
+		if s := got.String(); s != tt.wantString {
+			t.Errorf("ParseThrowpoint(%q).String() = %q, want %q", tt.in, s, tt.wantString)
+		}
+		// round-trip
+		if got2, err := ParseThrowpoint(got.String()); err != nil || !reflect.DeepEqual(got2, got) {
+			t.Errorf("ParseThrowpoint(%q) = (%v, %v), want %v", got.String(), got2, err, got)
+		}
+	}
+}
+
+func TestParseThrowpoint_error(t *testing.T) {
+	tests := []string{
+		"",
+		"function ",
+		"function F[1]..",
+		"script /path/to/file.vim[1]..G[2]",
+		`User Autocommands for "unterminated`,
+		"function F[x]",
+	}
+	for _, tt := range tests {
+		if got, err := ParseThrowpoint(tt); err == nil {
+			t.Errorf("ParseThrowpoint(%q) = %v, want error", tt, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// e.g. def F(), export def F(), static def F(), abstract def F(), def! g:F()
+	vim9DefRegex = regexp.MustCompile(`^\s*(?:export\s+)?(?:static\s+)?(abstract\s+)?(?:def|fu(?:n(?:c(?:t(?:i(?:o(?:n)?)?)?)?)?)?)!?\s+([^\s(]+)\s*\(`)
+	// e.g. enddef, endfunction
+	vim9EndDefRegex = regexp.MustCompile(`^\s*(?:enddef|endf(?:u(?:n(?:c(?:t(?:i(?:o(?:n)?)?)?)?)?)?)?)\b`)
+	// e.g. class C, export abstract class C, interface I, enum E
+	vim9ClassRegex = regexp.MustCompile(`^\s*(?:export\s+)?(?:abstract\s+)?(class|interface|enum)\s+(\w+)`)
+	// e.g. endclass, endinterface, endenum
+	vim9EndClassRegex = regexp.MustCompile(`^\s*(?:endclass|endinterface|endenum)\b`)
+)
+
+// isVim9script reports whether the script is Vim9 script. :h vim9script
+func isVim9script(lines []string) bool {
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, `"`) || strings.HasPrefix(l, "#") {
+			continue
+		}
+		return l == "vim9script" || strings.HasPrefix(l, "vim9script ")
+	}
+	return false
+}
+
+// vim9FuncLines builds function index from Vim9 script lines. go-vimlparser
+// cannot parse Vim9 script, so it scans def and function lines. Functions
+// without prefix are script local in Vim9 script. Class methods are indexed
+// as s:Class.Method which <SNR>N_Class.Method is converted to. The methods of
+// interface and abstract methods are declarations without body and enddef, so
+// they aren't indexed.
+func vim9FuncLines(lines []string) *funcIndex {
+	idx := &funcIndex{names: make(map[string]int), lines: lines}
+	class := ""
+	iface := false
+	// depth of def and function. Nested functions are local to the function.
+	depth := 0
+	for i, l := range lines {
+		lnum := i + 1
+		if m := vim9DefRegex.FindStringSubmatch(l); m != nil {
+			if depth == 0 && class != "" && (iface || m[1] != "") {
+				continue
+			}
+			depth++
+			if depth > 1 {
+				continue
+			}
+			name := m[2]
+			switch {
+			case class != "":
+				idx.names["s:"+class+"."+name] = lnum
+				idx.methods = append(idx.methods, &funcDef{name: name, lnum: lnum})
+			case strings.HasPrefix(name, "g:"), strings.HasPrefix(name, "s:"),
+				strings.HasPrefix(name, "<SID>"), strings.Contains(name, "#"):
+				idx.names[normalizeFuncname(name)] = lnum
+			default:
+				idx.names["s:"+name] = lnum
+			}
+			continue
+		}
+		switch {
+		case vim9EndDefRegex.MatchString(l):
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case vim9ClassRegex.MatchString(l):
+			m := vim9ClassRegex.FindStringSubmatch(l)
+			class, iface = m[2], m[1] == "interface"
+		case vim9EndClassRegex.MatchString(l):
+			class, iface = "", false
+		}
+	}
+	return idx
+}
+
+// lookupMethod returns the line number of the class method which has the
+// name without class name, which is the function name in throwpoint before
+// Vim 9.1. It returns 0 if not found or ambiguous.
+func (idx *funcIndex) lookupMethod(name string) int {
+	found := 0
+	for _, d := range idx.methods {
+		if d.name != name {
+			continue
+		}
+		if found != 0 {
+			return 0
+		}
+		found = d.lnum
+	}
+	return found
+}
+
+// resolveMethod resolves the definition of class method stack e from the
+// caller stack. :function cannot list class methods, but they are usually
+// called from the same script.
+func (cli *Vim) resolveMethod(e, caller *Stack) {
+	if caller.Filename == "" {
+		return
+	}
+	if strings.Contains(e.Funcname, ".") {
+		cli.resolveByName(e, caller.Filename)
+		return
+	}
+	idx := cli.funcIndex(caller.Filename)
+	if idx == nil {
+		return
+	}
+	l := idx.lookupMethod(e.Funcname)
+	if l == 0 {
+		return
+	}
+	e.setLocation(caller.Filename, l+e.Flnum, idx.lines)
+}
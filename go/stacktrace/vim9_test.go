@@ -0,0 +1,252 @@
+package stacktrace
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsVim9script(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "vim9script\ndef F()\nenddef", want: true},
+		{in: "\" comment\n# comment\n\nvim9script noclear", want: true},
+		{in: "function! F()\nendfunction\nvim9script", want: false},
+		{in: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := isVim9script(strings.Split(tt.in, "\n")); got != tt.want {
+			t.Errorf("isVim9script(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVim9FuncLines(t *testing.T) {
+	scripts := `vim9script
+
+def Foo(): number
+  def Nested()
+  enddef
+  return 1
+enddef
+
+export def Exp(): string
+  return ''
+enddef
+
+def g:Global()
+enddef
+
+function Legacy()
+endfunction
+
+def foo#bar()
+enddef
+
+export abstract class Cls
+  def Method(): string
+    return ''
+  enddef
+  static def SMethod(): string
+    return ''
+  enddef
+endclass
+
+class Cls2
+  def Method()
+  enddef
+endclass
+
+def After()
+enddef
+`
+	idx := vim9FuncLines(strings.Split(scripts, "\n"))
+	wantNames := map[string]int{
+		"s:Foo":         3,
+		"s:Exp":         9,
+		"Global":        13,
+		"s:Legacy":      16,
+		"foo#bar":       19,
+		"s:Cls.Method":  23,
+		"s:Cls.SMethod": 26,
+		"s:Cls2.Method": 32,
+		"s:After":       36,
+	}
+	if !reflect.DeepEqual(idx.names, wantNames) {
+		t.Errorf("vim9FuncLines() names = %v, want %v", idx.names, wantNames)
+	}
+
+	tests := []struct {
+		funcname string
+		want     int
+	}{
+		{"<SNR>2_Foo", 3},
+		{"<SNR>2_Nested", 0},
+		{"<SNR>2_Exp", 9},
+		{"Global", 13},
+		{"<SNR>2_Cls.Method", 23},
+		{"<SNR>2_Cls2.Method", 32},
+		{"SMethod", 26},
+		{"Method", 0}, // ambiguous
+	}
+	for _, tt := range tests {
+		if got := idx.lookup(tt.funcname, nil); got != tt.want {
+			t.Errorf("funcIndex.lookup(%v) = %v, want %v", tt.funcname, got, tt.want)
+		}
+	}
+}
+
+func TestVim9FuncLines_declaration(t *testing.T) {
+	scripts := `vim9script
+
+interface I
+  def Method(): number
+endinterface
+
+abstract class A implements I
+  abstract def Abs(): string
+  def Method(): number
+    return 1
+  enddef
+endclass
+
+def Foo()
+enddef
+`
+	idx := vim9FuncLines(strings.Split(scripts, "\n"))
+	want := map[string]int{
+		"s:A.Method": 9,
+		"s:Foo":      14,
+	}
+	if !reflect.DeepEqual(idx.names, want) {
+		t.Errorf("vim9FuncLines() names = %v, want %v", idx.names, want)
+	}
+}
+
+func TestVim_Build_vim9(t *testing.T) {
+	v := &Vim{c: cli}
+	if ok, err := cli.Expr("has('vim9script')"); err != nil || ok != float64(1) {
+		t.Skip("Vim9 script is not supported")
+	}
+	scripts := `vim9script
+
+def g:Vim9F(): string
+  return Cls.new().Method()
+enddef
+
+class Cls
+  def Method(): string
+    return Stack()
+  enddef
+endclass
+
+def Stack(): string
+  return expand('<stack>')
+enddef
+`
+	tmp, err := ioutil.TempFile("", "vim-stacktrace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	defer os.Remove(tmp.Name())
+	tmp.WriteString(scripts)
+	filename := tmp.Name()
+
+	if _, err := cli.Call("execute", ":source "+filename); err != nil {
+		t.Fatal(err)
+	}
+	throwpoint, err := cli.Expr("g:Vim9F()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := ParseThrowpoint(throwpoint.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := tp.Frames[len(tp.Frames)-3:]
+
+	got, err := v.build(&Throwpoint{Frames: frames})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := v.scriptTable()
+	id1, script1, _ := table.lookup(frames[1].Name)
+	id2, script2, _ := table.lookup(frames[2].Name)
+	want := []*Stack{
+		{
+			Funcname: "Vim9F",
+			Flnum:    1,
+			Line:     "  return Cls.new().Method()",
+			Filename: filename,
+			Lnum:     4,
+			Text:     "Vim9F:1:  return Cls.new().Method()",
+		},
+		{
+			Funcname: frames[1].Name,
+			ScriptID: id1,
+			Script:   script1,
+			Flnum:    1,
+			Line:     "    return Stack()",
+			Filename: filename,
+			Lnum:     9,
+			Text:     fmt.Sprintf("%v:1:    return Stack()", displayFuncname(frames[1].Name, script1)),
+		},
+		{
+			Funcname: frames[2].Name,
+			ScriptID: id2,
+			Script:   script2,
+			Flnum:    1,
+			Line:     "  return expand('<stack>')",
+			Filename: filename,
+			Lnum:     14,
+			Text:     fmt.Sprintf("%v:1:  return expand('<stack>')", displayFuncname(frames[2].Name, script2)),
+		},
+	}
+	if !reflect.DeepEqual(got.Stacks, want) {
+		for i, e := range got.Stacks {
+			t.Errorf("got :%#v", e)
+			t.Errorf("want:%#v", want[i])
+		}
+	}
+}
+
+func TestVim_buildFuncStack_shortDef(t *testing.T) {
+	tests := []struct {
+		out   string
+		flnum int
+		want  *Stack
+	}{
+		{
+			out:   "\n   def F()\n\tLast set from /path/to/file.vim line 3\n1  return 1\n   enddef",
+			flnum: 1,
+			want:  &Stack{Funcname: "F", Flnum: 1, Line: "return 1", Filename: "/path/to/file.vim", Lnum: 4, Text: "F:1:return 1"},
+		},
+		{
+			out:   "\n   def F()\n   enddef",
+			flnum: 1,
+			want:  &Stack{Funcname: "F", Flnum: 1, Text: "F:1:", Status: StatusOutOfRange, Error: "line 1 is not found in function F"},
+		},
+		{
+			out:   "\n   def F(): number",
+			flnum: 1,
+			want:  &Stack{Funcname: "F", Flnum: 1, Text: "F:1:", Status: StatusMalformed, Error: "function listing of F is not terminated"},
+		},
+		{
+			out:   "\n   enddef",
+			flnum: 1,
+			want:  &Stack{Funcname: "F", Flnum: 1, Text: "F:1:", Status: StatusMalformed, Error: `unexpected function listing: "   enddef"`},
+		},
+	}
+	for _, tt := range tests {
+		v := &Vim{c: listingClient(tt.out)}
+		if got := v.buildFuncStack(&Frame{Name: "F", Lnum: tt.flnum}, nil); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("buildFuncStack() with %q\ngot:  %#v\nwant: %#v", tt.out, got, tt.want)
+		}
+	}
+}
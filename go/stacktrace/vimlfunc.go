@@ -1,6 +1,10 @@
 package stacktrace
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 // func (cli *Vim) debug(msg interface{}) {
 // 	cli.c.Ex("echom " + strconv.Quote(fmt.Sprintf("%+#v", msg)))
@@ -15,7 +19,115 @@ func (cli *Vim) sfile() (string, error) {
 }
 
 func (cli *Vim) function(funcname string) (string, error) {
-	return cli.callstrfunc("execute", fmt.Sprintf(":verbose function %v", funcname))
+	if !isFuncname(funcname) {
+		return "", fmt.Errorf("invalid function name: %q", funcname)
+	}
+	return cli.execute(functionCmd(funcname))
+}
+
+func (cli *Vim) scriptnames() (string, error) {
+	return cli.execute(scriptnamesCmd)
+}
+
+// autocmd returns the listing of all autocommands. The autocommand of event
+// and pattern is looked up in it not to put them in :autocmd.
+func (cli *Vim) autocmd(event, pattern string) (string, error) {
+	if !isAutocmd(event, pattern) {
+		return "", fmt.Errorf("invalid autocmd: %q %q", event, pattern)
+	}
+	return cli.execute(autocmdCmd)
+}
+
+var (
+	// function names in throwpoint. e.g. F, foo#bar, <SNR>3_f, <SNR>3_Cls.new,
+	// <lambda>3, 14, {14}
+	funcnameRegex = regexp.MustCompile(`^(?:<lambda>\d+|\d+|\{\d+\}|(?:<SNR>\d+_)?[A-Za-z_][\w#]*(?:\.[A-Za-z_]\w*)?)$`)
+	// autocmd event and pattern. Pattern cannot contain white spaces.
+	autocmdEventRegex   = regexp.MustCompile(`^\w+$`)
+	autocmdPatternRegex = regexp.MustCompile(`^[^\s|"]+$`)
+)
+
+// isFuncname reports whether name is a valid function name. The frame with
+// invalid name, e.g. broken throwpoint, isn't looked up.
+func isFuncname(name string) bool {
+	return funcnameRegex.MatchString(name)
+}
+
+// isAutocmd reports whether event and pattern are valid.
+func isAutocmd(event, pattern string) bool {
+	return autocmdEventRegex.MatchString(event) && autocmdPatternRegex.MatchString(pattern)
+}
+
+// exCmd is the Ex command to get the definitions. It's also the key of batch.
+// Arg is passed to Vim as data and expanded by {v:val[1]} in Cmd as
+// curly-braces-names, so the name from throwpoint is never parsed as a part
+// of the command. :h curly-braces-names
+type exCmd struct {
+	Cmd string
+	Arg string
+}
+
+func (c exCmd) String() string {
+	return strings.Replace(c.Cmd, "{v:val[1]}", c.Arg, 1)
+}
+
+// executeExpr executes exCmd for map(). The errors are silenced to get the
+// other outputs, so the output of the failed command is empty.
+const executeExpr = "execute(v:val[0], 'silent!')"
+
+var (
+	scriptnamesCmd = exCmd{Cmd: ":scriptnames"}
+	autocmdCmd     = exCmd{Cmd: ":verbose autocmd"}
+)
+
+func functionCmd(funcname string) exCmd {
+	// <SNR> isn't expanded in curly-braces-names.
+	if strings.HasPrefix(funcname, "<SNR>") {
+		return exCmd{Cmd: ":verbose function <SNR>{v:val[1]}", Arg: strings.TrimPrefix(funcname, "<SNR>")}
+	}
+	// {14} is the curly-braces-name of 14 itself.
+	if strings.HasPrefix(funcname, "{") {
+		funcname = strings.Trim(funcname, "{}")
+	}
+	return exCmd{Cmd: ":verbose function {v:val[1]}", Arg: funcname}
+}
+
+// execute returns the output of cmd.
+func (cli *Vim) execute(cmd exCmd) (string, error) {
+	outs, err := cli.executeAll([]exCmd{cmd})
+	if err != nil {
+		return "", err
+	}
+	if outs[0] == "" {
+		return "", fmt.Errorf("%s failed", cmd)
+	}
+	return outs[0], nil
+}
+
+// executeAll returns the outputs of cmds by a single call. The output of the
+// failed command is empty.
+func (cli *Vim) executeAll(cmds []exCmd) ([]string, error) {
+	args := make([][]string, 0, len(cmds))
+	for _, c := range cmds {
+		args = append(args, []string{c.Cmd, c.Arg})
+	}
+	ret, err := cli.c.Call("map", args, executeExpr)
+	if err != nil {
+		return nil, err
+	}
+	outs, ok := ret.([]interface{})
+	if !ok || len(outs) != len(cmds) {
+		return nil, fmt.Errorf("map(%v) returns unexpected value: %v", cmds, ret)
+	}
+	strs := make([]string, 0, len(outs))
+	for _, out := range outs {
+		s, ok := out.(string)
+		if !ok {
+			return nil, fmt.Errorf("map(%v) returns non string: %v", cmds, out)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
 }
 
 func (cli *Vim) callstrfunc(f string, args ...interface{}) (string, error) {
@@ -35,9 +147,14 @@ func (cli *Vim) callintfunc(f string, args ...interface{}) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	s, ok := ret.(float64)
-	if ok {
-		return int(s), nil
+	// JSON number is float64 and msgpack integer is int64 or uint64.
+	switch n := ret.(type) {
+	case float64:
+		return int(n), nil
+	case int64:
+		return int(n), nil
+	case uint64:
+		return int(n), nil
 	}
-	return 0, fmt.Errorf("%v(%v) is not float64: %v", f, args, ret)
+	return 0, fmt.Errorf("%v(%v) is not number: %v", f, args, ret)
 }
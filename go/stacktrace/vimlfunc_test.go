@@ -23,7 +23,7 @@ func TestVimfunction(t *testing.T) {
 function! Hoge()
 endfunction
 `
-		v.c.Call("execute", f)
+		cli.Call("execute", f)
 
 		got, err := v.function("Hoge")
 		if err != nil {
@@ -35,6 +35,68 @@ endfunction
 	}
 }
 
+func TestIsFuncname(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"F", true},
+		{"foo#bar#Baz", true},
+		{"<SNR>13_test", true},
+		{"<SNR>13_Cls.new", true},
+		{"<lambda>3", true},
+		{"14", true},
+		{"{14}", true},
+		{"", false},
+		{"F|call system('rm')", false},
+		{"F\nlet g:x = 1", false},
+		{"F G", false},
+		{"<SNR>_f", false},
+		{"g:F", false},
+		{"{x}", false},
+	}
+	for _, tt := range tests {
+		if got := isFuncname(tt.in); got != tt.want {
+			t.Errorf("isFuncname(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVim_injection(t *testing.T) {
+	v := &Vim{c: cli}
+	if got, err := v.function("F|let g:injected = 1"); err == nil {
+		t.Errorf("Vim.function() returns %q, want error", got)
+	}
+	v.buildFuncStack(&Frame{Name: "F|let g:injected = 1", Lnum: 1}, nil)
+	if got, err := v.autocmd("User", "Foo|let g:injected = 1"); err == nil {
+		t.Errorf("Vim.autocmd() returns %q, want error", got)
+	}
+	v.build(&Throwpoint{Frames: []*Frame{
+		{Kind: FrameFunction, Name: "F|let g:injected = 1", Lnum: 1},
+		{Kind: FrameAutocmd, Event: "User", Pattern: "Foo let g:injected = 1"},
+	}})
+	// the name is passed as data even if it isn't validated.
+	for _, name := range []string{"F|let g:injected = 1", "<SNR>1_f|let g:injected = 1", "F\nlet g:injected = 1"} {
+		if got, err := v.execute(functionCmd(name)); err == nil {
+			t.Errorf("Vim.execute(%v) returns %q, want error", functionCmd(name), got)
+		}
+	}
+	// the frame with invalid name is kept as StatusInvalid.
+	got, err := v.Build("function Main[1]..F|let g:injected = 1[2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Stacks) != 2 || got.Stacks[1].Status != StatusInvalid || got.Stacks[1].Funcname != "F|let g:injected = 1" {
+		t.Errorf("Vim.Build() = %#v", got.Stacks)
+	}
+	if got, err := cli.Expr("exists('g:injected')"); err != nil || got != float64(0) {
+		t.Errorf("g:injected exists: %v, %v", got, err)
+	}
+	if got, err := cli.Expr("exists('#User#Foo')"); err != nil || got != float64(0) {
+		t.Errorf("autocmd is defined: %v, %v", got, err)
+	}
+}
+
 func TestVimCallstrfunc(t *testing.T) {
 	v := &Vim{c: cli}
 	{
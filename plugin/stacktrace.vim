@@ -20,7 +20,9 @@ command! LStacktraceFromhist call s:fromhist('l')
 function! s:fromhist(type) abort
   let stacktrace = stacktrace#fromhist()
   if stacktrace isnot# v:null
-    let locs = stacktrace.stacks
+    " the messages before the error are shown as information.
+    let context = map(copy(get(stacktrace, 'context', [])), "{'text': v:val, 'type': 'I'}")
+    let locs = context + stacktrace.stacks
     if a:type is# 'c'
       call setqflist(locs)
     elseif a:type is# 'l'
@@ -29,6 +31,15 @@ function! s:fromhist(type) abort
   endif
 endfunction
 
+" Keep the scripts as they're sourced to resolve the stacktrace even if they
+" are edited later. The oldest snapshots are dropped when they exceed 32 MiB.
+if get(g:, 'stacktrace#snapshot', v:false) && exists('##SourcePost')
+  augroup stacktrace-snapshot
+    autocmd!
+    autocmd SourcePost * call stacktrace#snapshot(expand('<afile>:p'))
+  augroup END
+endif
+
 let &cpo = s:save_cpo
 unlet s:save_cpo
 " __END__